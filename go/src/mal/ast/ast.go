@@ -2,27 +2,69 @@ package ast
 
 import (
 	"fmt"
+	"io"
+	"strings"
 
 	"mal/ast/token"
 )
 
+// IncompleteError is returned if the input ends in the middle of a form,
+// e.g. "(a b", appending more input may complete it. Callers such as the REPL
+// use it to tell the unfinished input from the real syntax errors.
+type IncompleteError struct {
+	Pos token.Pos
+	Msg string
+}
+
+func (e *IncompleteError) Error() string {
+	return fmt.Sprintf("[%s] %s", e.Pos, e.Msg)
+}
+
+// SyntaxError is returned if the input is not valid code.
+type SyntaxError struct {
+	Pos token.Pos
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("[%s] %s", e.Pos, e.Msg)
+}
+
+func errorf(pos token.Pos, format string, args ...interface{}) error {
+	return &SyntaxError{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func incompletef(pos token.Pos, format string, args ...interface{}) error {
+	return &IncompleteError{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// IsIncomplete reports whether err is caused by the incomplete input.
+func IsIncomplete(err error) bool {
+	_, ok := err.(*IncompleteError)
+	return ok
+}
+
 type AST struct {
+	// Features are the names of the keywords selected by the reader
+	// conditional #?(:go ... :default ...), :default is always selected.
+	Features []string
+
 	tr    *tokenReader
 	nodes []Node
 }
 
 func (ast *AST) Parse(code string) error {
-	ast.tr = newTokenReader(code)
+	d := NewDecoder(strings.NewReader(code), ast.Features...)
 	ast.nodes = []Node{}
 
 	for {
-		node, err := ast.processForm()
+		node, err := d.Decode()
+		if err == io.EOF {
+			break
+		}
 		if err != nil {
 			return err
 		}
-		if node == nil {
-			break
-		}
 		ast.nodes = append(ast.nodes, node)
 	}
 	return nil
@@ -47,7 +89,7 @@ func (ast *AST) processForm() (Node, error) {
 	case token.EOF:
 		return nil, nil
 	case token.ILLEGAL:
-		err = fmt.Errorf("[%s] illegal syntax: %s", t.Pos, t.Content)
+		err = errorf(t.Pos, "illegal syntax: %s", t.Content)
 	case token.COMMENT: // ;
 		node, err = ast.processComment()
 	case token.TILDEAT: // ~@
@@ -64,6 +106,12 @@ func (ast *AST) processForm() (Node, error) {
 		node, err = ast.processMacro("deref", t.Pos)
 	case token.LPAREN: // (
 		node, err = ast.processList()
+	case token.HASHLPAREN: // #(
+		node, err = ast.processAnonFn()
+	case token.HASHUNDERSCORE: // #_
+		node, err = ast.processDiscard(t.Pos)
+	case token.HASHQUESTION: // #?
+		node, err = ast.processReaderConditional(t.Pos)
 	default:
 		node, err = ast.processAtom()
 	}
@@ -91,13 +139,13 @@ func (ast *AST) processMacro(macro string, pos token.Pos) (Node, error) {
 		Elems: make([]Node, 1),
 	}
 	if macro == "with-meta" {
-		meta, err := ast.processForm()
+		meta, err := ast.processOperand(macro, pos)
 		if err != nil {
 			return nil, err
 		}
 		node.Elems = append(node.Elems, meta)
 	}
-	n, err := ast.processForm()
+	n, err := ast.processOperand(macro, pos)
 	if err != nil {
 		return nil, err
 	}
@@ -105,13 +153,39 @@ func (ast *AST) processMacro(macro string, pos token.Pos) (Node, error) {
 	return node, nil
 }
 
+// processOperand reads the form which the reader macro at pos applies to,
+// comments and discarded forms in between are skipped, e.g. '#_ 1 2 -> '2.
+func (ast *AST) processOperand(macro string, pos token.Pos) (Node, error) {
+	for {
+		t, err := ast.tr.Peek()
+		if err != nil {
+			return nil, err
+		}
+		switch t.Token {
+		case token.EOF:
+			return nil, incompletef(pos, "unexpected EOF after %s", macro)
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			return nil, errorf(t.Pos, "unexpected '%s' after %s", t.Content, macro)
+		}
+		node, err := ast.processForm()
+		if err != nil {
+			return nil, err
+		}
+		switch node.(type) {
+		case *Comment, *Discard:
+			continue
+		}
+		return node, nil
+	}
+}
+
 func (ast *AST) processList() (Node, error) {
 	t, err := ast.tr.Next()
 	if err != nil {
 		return nil, err
 	}
 	if t.Token != token.LPAREN {
-		return nil, fmt.Errorf("[%s] expect '(', got '%s'", t.Pos, t.Content)
+		return nil, errorf(t.Pos, "expect '(', got '%s'", t.Content)
 	}
 
 	node := &List{
@@ -126,6 +200,78 @@ func (ast *AST) processList() (Node, error) {
 	return node, err
 }
 
+func (ast *AST) processAnonFn() (Node, error) {
+	t, err := ast.tr.Next()
+	if err != nil {
+		return nil, err
+	}
+
+	node := &AnonFn{
+		pos:   t.Pos,
+		Elems: []Node{},
+	}
+	t, err = ast.processContainer(&(node.Elems), token.RPAREN)
+	if err != nil {
+		return nil, err
+	}
+	node.end = t.End
+	return node, err
+}
+
+// processDiscard reads the form after #_, e.g. #_ #_ 1 2 discards both.
+func (ast *AST) processDiscard(pos token.Pos) (Node, error) {
+	ast.tr.Next()
+	node, err := ast.processOperand("#_", pos)
+	if err != nil {
+		return nil, err
+	}
+	return &Discard{pos: pos, Node: node}, nil
+}
+
+// processReaderConditional returns the form of the first matched feature,
+// the whole conditional is discarded if none is matched.
+func (ast *AST) processReaderConditional(pos token.Pos) (Node, error) {
+	ast.tr.Next()
+	t, err := ast.tr.Next()
+	if err != nil {
+		return nil, err
+	}
+	if t.Token == token.EOF {
+		return nil, incompletef(pos, "unexpected EOF after #?")
+	}
+	if t.Token != token.LPAREN {
+		return nil, errorf(t.Pos, "expect '(' after #?, got '%s'", t.Content)
+	}
+
+	elems := []Node{}
+	end, err := ast.processContainer(&elems, token.RPAREN)
+	if err != nil {
+		return nil, err
+	}
+	if len(elems)%2 != 0 {
+		return nil, errorf(pos, "reader conditional requires an even number of forms")
+	}
+	for i := 0; i < len(elems); i += 2 {
+		feature, ok := elems[i].(*AtomSingle)
+		if !ok || feature.Kind != Keyword {
+			return nil, errorf(elems[i].Pos(), "feature should be a keyword, got %s", elems[i])
+		}
+		if name := feature.Content[1:]; ast.hasFeature(name) || name == "default" {
+			return elems[i+1], nil
+		}
+	}
+	return &Discard{pos: pos, Node: NewList(t.Pos, end.End, elems...)}, nil
+}
+
+func (ast *AST) hasFeature(name string) bool {
+	for _, feature := range ast.Features {
+		if feature == name {
+			return true
+		}
+	}
+	return false
+}
+
 func (ast *AST) processAtom() (Node, error) {
 	t, err := ast.tr.Next()
 	if err != nil {
@@ -138,6 +284,8 @@ func (ast *AST) processAtom() (Node, error) {
 		node, err = ast.processAtomContainer(Vector, t)
 	case token.LBRACE: // {
 		node, err = ast.processAtomContainer(Map, t)
+	case token.HASHLBRACE: // #{
+		node, err = ast.processAtomContainer(Set, t)
 	case token.NIL:
 		node = ast.processKindAtomSingle(Nil, t)
 	case token.BOOL:
@@ -146,10 +294,16 @@ func (ast *AST) processAtom() (Node, error) {
 		node = ast.processKindAtomSingle(Int, t)
 	case token.FLOAT:
 		node = ast.processKindAtomSingle(Float, t)
+	case token.RATIO:
+		node = ast.processKindAtomSingle(Ratio, t)
 	case token.STRING:
 		node = ast.processKindAtomSingle(String, t)
 	case token.KEYWORD:
 		node = ast.processKindAtomSingle(Keyword, t)
+	case token.CHAR:
+		node = ast.processKindAtomSingle(Char, t)
+	case token.REGEX:
+		node = ast.processKindAtomSingle(Regex, t)
 	default:
 		node, err = ast.processAtomSingle(t)
 	}
@@ -186,7 +340,7 @@ func (ast *AST) processAtomContainer(kind AtomKind, t TokenWraper) (Node, error)
 	var endToken token.Token
 	if kind == Vector {
 		endToken = token.RBRACK
-	} else if kind == Map {
+	} else if kind == Map || kind == Set {
 		endToken = token.RBRACE
 	}
 	t, err := ast.processContainer(&(node.Elems), endToken)
@@ -197,6 +351,13 @@ func (ast *AST) processAtomContainer(kind AtomKind, t TokenWraper) (Node, error)
 	return node, err
 }
 
+// closing maps the end token of the containers to its delimiter.
+var closing = map[token.Token]string{
+	token.RPAREN: ")",
+	token.RBRACK: "]",
+	token.RBRACE: "}",
+}
+
 func (ast *AST) processContainer(elems *[]Node, endToken token.Token) (t TokenWraper, err error) {
 	var n Node
 	for {
@@ -205,16 +366,25 @@ func (ast *AST) processContainer(elems *[]Node, endToken token.Token) (t TokenWr
 			return
 		}
 		if t.Token == token.EOF {
-			err = fmt.Errorf("[%s] unexpected EOF", t.Pos)
+			err = incompletef(t.Pos, "expected '%s', got EOF", closing[endToken])
 			return
 		}
 		if t.Token == endToken {
 			break
 		}
+		switch t.Token {
+		case token.RPAREN, token.RBRACK, token.RBRACE: // Mismatched, e.g. (1 2]
+			err = errorf(t.Pos, "expected '%s', got '%s'", closing[endToken], t.Content)
+			return
+		}
 		n, err = ast.processForm()
 		if err != nil {
 			return
 		}
+		switch n.(type) {
+		case *Comment, *Discard: // Meaningless inside forms
+			continue
+		}
 		*elems = append(*elems, n)
 	}
 	t, _ = ast.tr.Next()
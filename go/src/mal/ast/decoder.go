@@ -0,0 +1,28 @@
+package ast
+
+import "io"
+
+// Decoder reads and parses the top level forms one by one from an input
+// stream, the input is only read as far as the current form needs.
+type Decoder struct {
+	ast *AST
+}
+
+// NewDecoder returns a decoder which reads from r, features are selected by
+// the reader conditionals, see AST.Features.
+func NewDecoder(r io.Reader, features ...string) *Decoder {
+	return &Decoder{ast: &AST{Features: features, tr: newTokenReader(r)}}
+}
+
+// Decode returns the next top level form, comments are returned as well.
+// io.EOF is returned if there are no more forms.
+func (d *Decoder) Decode() (Node, error) {
+	node, err := d.ast.processForm()
+	if err != nil {
+		return nil, err
+	}
+	if node == nil {
+		return nil, io.EOF
+	}
+	return node, nil
+}
@@ -14,10 +14,14 @@ const (
 	Bool
 	Int
 	Float
+	Ratio
 	String
 	Keyword
+	Char
+	Regex
 	Vector
 	Map
+	Set
 )
 
 type (
@@ -35,12 +39,12 @@ type (
 		pos     token.Pos
 		Content string
 	}
-	AtomSingle struct { // nil true false number string keyword
+	AtomSingle struct { // nil true false number string keyword char regex
 		pos     token.Pos
 		Kind    AtomKind
 		Content string
 	}
-	AtomContainer struct { // vector map
+	AtomContainer struct { // vector map set
 		pos   token.Pos
 		end   token.Pos
 		Kind  AtomKind
@@ -51,8 +55,29 @@ type (
 		Symbol *Symbol
 		Elems  []Node
 	}
+	Discard struct { // #_form
+		pos  token.Pos
+		Node Node
+	}
+	AnonFn struct { // #(+ % 1)
+		pos   token.Pos
+		end   token.Pos
+		Elems []Node
+	}
 )
 
+func NewSymbol(pos token.Pos, content string) *Symbol {
+	return &Symbol{pos: pos, Content: content}
+}
+
+func NewAtomContainer(kind AtomKind, pos, end token.Pos, elems ...Node) *AtomContainer {
+	return &AtomContainer{pos: pos, end: end, Kind: kind, Elems: elems}
+}
+
+func NewList(pos, end token.Pos, elems ...Node) *List {
+	return &List{end: end, Symbol: &Symbol{pos: pos}, Elems: elems}
+}
+
 func (c *Comment) Pos() token.Pos {
 	return c.pos
 }
@@ -101,9 +126,6 @@ func (a *AtomSingle) End() token.Pos {
 }
 
 func (a *AtomSingle) String() string {
-	if a.Kind == String {
-		return fmt.Sprintf("%q", a.Content[1:len(a.Content)-1])
-	}
 	return a.Content
 }
 
@@ -125,6 +147,9 @@ func (a *AtomContainer) String() string {
 	case Map:
 		elems[0] = "{"
 		elems[n+1] = "}"
+	case Set:
+		elems[0] = "#{"
+		elems[n+1] = "}"
 	}
 	for i, elem := range a.Elems {
 		elems[i+1] = elem.String()
@@ -152,3 +177,31 @@ func (l *List) String() string {
 	}
 	return fmt.Sprintf("(%s%s)", macro, strings.Join(elems, " "))
 }
+
+func (d *Discard) Pos() token.Pos {
+	return d.pos
+}
+
+func (d *Discard) End() token.Pos {
+	return d.Node.End()
+}
+
+func (d *Discard) String() string {
+	return "#_" + d.Node.String()
+}
+
+func (f *AnonFn) Pos() token.Pos {
+	return f.pos
+}
+
+func (f *AnonFn) End() token.Pos {
+	return f.end
+}
+
+func (f *AnonFn) String() string {
+	elems := make([]string, len(f.Elems))
+	for i, elem := range f.Elems {
+		elems[i] = elem.String()
+	}
+	return fmt.Sprintf("#(%s)", strings.Join(elems, " "))
+}
@@ -4,7 +4,8 @@ import "fmt"
 
 func PrintAST(ast *AST) {
 	ast.Walk(func(node Node) bool {
-		if _, ok := node.(*Comment); ok {
+		switch node.(type) {
+		case *Comment, *Discard:
 			return true
 		}
 		fmt.Printf("%s\n", node)
@@ -3,8 +3,13 @@ package ast
 import (
 	"bufio"
 	"bytes"
+	"fmt"
 	"io"
+	"regexp"
+	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf16"
 
 	"mal/ast/token"
 )
@@ -26,9 +31,9 @@ type tokenReader struct {
 	tokens []TokenWraper
 }
 
-func newTokenReader(code string) *tokenReader {
+func newTokenReader(rd io.Reader) *tokenReader {
 	return &tokenReader{
-		rd:     bufio.NewReader(bytes.NewBufferString(code)),
+		rd:     bufio.NewReader(rd),
 		buf:    new(bytes.Buffer),
 		tokens: []TokenWraper{},
 		end:    token.Pos{Line: 1},
@@ -75,21 +80,27 @@ func (r *tokenReader) nexttoken() (tw TokenWraper, err error) {
 	switch b {
 	case '(':
 		r.discardByte()
+		r.buf.WriteByte(b)
 		t = token.LPAREN
 	case ')':
 		r.discardByte()
+		r.buf.WriteByte(b)
 		t = token.RPAREN
 	case '[':
 		r.discardByte()
+		r.buf.WriteByte(b)
 		t = token.LBRACK
 	case ']':
 		r.discardByte()
+		r.buf.WriteByte(b)
 		t = token.RBRACK
 	case '{':
 		r.discardByte()
+		r.buf.WriteByte(b)
 		t = token.LBRACE
 	case '}':
 		r.discardByte()
+		r.buf.WriteByte(b)
 		t = token.RBRACE
 	case '"':
 		t, err = r.readString()
@@ -97,9 +108,13 @@ func (r *tokenReader) nexttoken() (tw TokenWraper, err error) {
 		t, err = r.readComment()
 	case ':':
 		t, err = r.readKeyword()
+	case '\\':
+		t, err = r.readChar()
+	case '#':
+		t, err = r.readDispatch()
 	case '\'', '`', '~', '^', '@':
 		t, err = r.readSpecialSymbol()
-	case '-': // '+' ????
+	case '-', '+':
 		var bs []byte
 		bs, err = r.peekBytes(2)
 		if err == nil && (bs[1] >= '0' && bs[1] <= '9') {
@@ -132,12 +147,11 @@ func (r *tokenReader) makeTokenWrapper(t token.Token) TokenWraper {
 	}
 }
 
+// readNumber reads the whole word and classifies it, malformed numbers such
+// as 1.2.3 and the floats out of range such as 1e400 are reported as ILLEGAL.
 func (r *tokenReader) readNumber() (t token.Token, err error) {
-	isfloat := false
-	b, _ := r.nextByte()
-	r.buf.WriteByte(b)
-
 	for {
+		var b byte
 		b, err = r.peekByte()
 		if err != nil {
 			if err == io.EOF {
@@ -146,80 +160,181 @@ func (r *tokenReader) readNumber() (t token.Token, err error) {
 			}
 			return
 		}
-		if !(b >= '0' && b <= '9') && b != '.' {
+		if isDelimiter(b) {
 			break
 		}
 		r.discardByte()
-		if b == '.' {
-			if isfloat {
-				return
-			}
-			isfloat = true
-		}
 		r.buf.WriteByte(b)
 	}
-
-	if isfloat {
-		t = token.FLOAT
-	} else {
-		t = token.INT
-	}
+	t = numberToken(r.buf.String())
 	return
 }
 
-func (r *tokenReader) readString() (t token.Token, err error) {
-	isfirst, slashs := true, 0
-	write := func(b byte) {
-		if slashs > 0 {
-			if n := slashs / 2; n > 0 {
-				r.buf.WriteString(strings.Repeat("\\", n))
-			}
-			if n := slashs % 2; n == 1 {
-				switch b {
-				case 'n':
-					r.buf.WriteByte('\n')
-				case 'r':
-					r.buf.WriteByte('\r')
-				case 't':
-					r.buf.WriteByte('\t')
-				case 'f':
-					r.buf.WriteByte('\f')
-				case 'b':
-					r.buf.WriteByte('\b')
-				default:
-					r.buf.WriteByte(b)
-				}
-			} else {
-				r.buf.WriteByte(b)
+const (
+	decDigits = `[0-9]+(_[0-9]+)*`
+	exponent  = `[eE][+-]?` + decDigits
+)
+
+var numberPatterns = []struct {
+	re *regexp.Regexp
+	t  token.Token
+}{
+	{regexp.MustCompile(`^[+-]?(0[xX][0-9a-fA-F]+(_[0-9a-fA-F]+)*|0[oO][0-7]+(_[0-7]+)*|0[bB][01]+(_[01]+)*|` + decDigits + `)$`), token.INT},
+	{regexp.MustCompile(`^[+-]?` + decDigits + `(\.(` + decDigits + `)?(` + exponent + `)?|` + exponent + `)$`), token.FLOAT},
+	{regexp.MustCompile(`^[+-]?` + decDigits + `/` + decDigits + `$`), token.RATIO},
+}
+
+func numberToken(s string) token.Token {
+	for _, p := range numberPatterns {
+		if !p.re.MatchString(s) {
+			continue
+		}
+		if p.t == token.FLOAT {
+			if _, err := strconv.ParseFloat(strings.Replace(s, "_", "", -1), 64); err != nil {
+				return token.ILLEGAL
 			}
-		} else {
-			r.buf.WriteByte(b)
 		}
+		return p.t
 	}
+	return token.ILLEGAL
+}
+
+func isDelimiter(b byte) bool {
+	switch b {
+	case ' ', '\n', '\r', '\t', '\f', '\b', ',', ';', '"', '(', ')', '[', ']', '{', '}':
+		return true
+	}
+	return false
+}
+
+// readString reads the string literal as it is, the escape sequences are
+// checked here and decoded by Unquote.
+func (r *tokenReader) readString() (t token.Token, err error) {
+	b, _ := r.nextByte()
+	r.buf.WriteByte(b)
 	for {
-		var b byte
+		pos := r.end
 		b, err = r.nextByte()
 		if err != nil {
 			if err == io.EOF {
-				t, err = token.EOF, nil
+				err = incompletef(r.pos, "unterminated string, expected '\"', got EOF")
 			}
 			return
 		}
+		r.buf.WriteByte(b)
 		switch b {
-		case '\\':
-			slashs++
 		case '"':
-			write(b)
-			if !isfirst && slashs%2 == 0 {
-				t = token.STRING
+			t = token.STRING
+			return
+		case '\\':
+			bs := r.peekEscape()
+			if len(bs) == 0 {
+				continue // reports the unterminated string
+			}
+			_, n, ok := unescape(string(bs))
+			if !ok {
+				if bs[0] == 'u' && len(bs) >= 5 {
+					bs = bs[:5]
+				} else {
+					bs = bs[:1]
+				}
+				err = errorf(pos, "invalid escape sequence: \\%s", bs)
 				return
 			}
-			isfirst, slashs = false, 0
-		default:
-			write(b)
-			slashs = 0
+			r.buf.Write(bs[:n])
+			r.discardBytes(n)
+		}
+	}
+}
+
+// peekEscape peeks the escape sequence after the backslash, it peeks no more
+// bytes than the sequence needs, the stream may not have more bytes yet.
+func (r *tokenReader) peekEscape() []byte {
+	bs, _ := r.peekBytes(1)
+	if len(bs) == 0 || bs[0] != 'u' {
+		return bs
+	}
+	bs, _ = r.peekBytes(5)
+	if x, ok := hexRune(bs); !ok || !utf16.IsSurrogate(x) {
+		return bs
+	}
+	// The high surrogate is followed by \uXXXX of the low one.
+	if next, _ := r.peekBytes(6); len(next) < 6 || next[5] != '\\' {
+		return bs
+	}
+	if next, _ := r.peekBytes(7); len(next) < 7 || next[6] != 'u' {
+		return bs
+	}
+	bs, _ = r.peekBytes(11)
+	return bs
+}
+
+// escapes maps the escape characters to what they stand for, \uXXXX is
+// handled by unescape.
+var escapes = map[byte]rune{
+	'n':  '\n',
+	'r':  '\r',
+	't':  '\t',
+	'f':  '\f',
+	'b':  '\b',
+	'"':  '"',
+	'\\': '\\',
+}
+
+// unescape decodes the escape sequence at the beginning of s, the backslash
+// excluded, it returns the rune and the length of the sequence. A surrogate
+// pair is decoded from two \uXXXX, e.g. \ud83d\ude00, the lone surrogates
+// are invalid.
+func unescape(s string) (rune, int, bool) {
+	if len(s) == 0 {
+		return 0, 0, false
+	}
+	if r, ok := escapes[s[0]]; ok {
+		return r, 1, true
+	}
+	r, ok := hexRune([]byte(s))
+	if !ok {
+		return 0, 0, false
+	}
+	if !utf16.IsSurrogate(r) {
+		return r, 5, true
+	}
+	if len(s) >= 11 && s[5] == '\\' {
+		if r2, ok := hexRune([]byte(s[6:])); ok {
+			if c := utf16.DecodeRune(r, r2); c != unicode.ReplacementChar {
+				return c, 11, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// hexRune parses the rune of uXXXX at the beginning of bs.
+func hexRune(bs []byte) (rune, bool) {
+	if len(bs) < 5 || bs[0] != 'u' {
+		return 0, false
+	}
+	x, err := strconv.ParseUint(string(bs[1:5]), 16, 32)
+	return rune(x), err == nil
+}
+
+// Unquote decodes the string literal read by the reader, e.g. "a\tb".
+func Unquote(lit string) (string, error) {
+	s := lit[1 : len(lit)-1]
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		r, n, ok := unescape(s[i+1:])
+		if !ok {
+			return "", fmt.Errorf("invalid escape sequence in %s", lit)
 		}
+		b.WriteRune(r)
+		i += n
 	}
+	return b.String(), nil
 }
 
 func (r *tokenReader) readSpecialSymbol() (t token.Token, err error) {
@@ -282,6 +397,124 @@ func (r *tokenReader) readKeyword() (t token.Token, err error) {
 	return
 }
 
+// dispatch maps the character after '#' to the token, #"..." is read by
+// readRegex and ##Inf by readSymbolicValue.
+var dispatch = map[byte]token.Token{
+	'{': token.HASHLBRACE,
+	'(': token.HASHLPAREN,
+	'_': token.HASHUNDERSCORE,
+	'?': token.HASHQUESTION,
+}
+
+func (r *tokenReader) readDispatch() (t token.Token, err error) {
+	bs, _ := r.peekBytes(2)
+	if len(bs) < 2 {
+		return token.ILLEGAL, incompletef(r.pos, "unexpected EOF after #")
+	}
+	switch bs[1] {
+	case '"':
+		return r.readRegex()
+	case '#':
+		return r.readSymbolicValue()
+	}
+	t, ok := dispatch[bs[1]]
+	if !ok {
+		t = token.ILLEGAL
+	}
+	r.discardBytes(2)
+	r.buf.Write(bs)
+	return t, nil
+}
+
+// readRegex reads the regex literal as it is, only \" is escaped so that the
+// pattern needs no double escaping, e.g. #"\d+".
+func (r *tokenReader) readRegex() (t token.Token, err error) {
+	r.discardBytes(2)
+	r.buf.WriteString(`#"`)
+	escaped := false
+	for {
+		var b byte
+		b, err = r.nextByte()
+		if err != nil {
+			if err == io.EOF {
+				err = incompletef(r.pos, "unterminated regex, expected '\"', got EOF")
+			}
+			return
+		}
+		r.buf.WriteByte(b)
+		switch {
+		case escaped:
+			escaped = false
+		case b == '\\':
+			escaped = true
+		case b == '"':
+			t = token.REGEX
+			return
+		}
+	}
+}
+
+// readSymbolicValue reads the special floats ##Inf, ##-Inf and ##NaN.
+func (r *tokenReader) readSymbolicValue() (t token.Token, err error) {
+	r.discardBytes(2)
+	r.buf.WriteString("##")
+	for {
+		var b byte
+		b, err = r.peekByte()
+		if err != nil {
+			if err == io.EOF {
+				err = nil
+				break
+			}
+			return
+		}
+		if isDelimiter(b) {
+			break
+		}
+		r.discardByte()
+		r.buf.WriteByte(b)
+	}
+	switch r.buf.String() {
+	case "##Inf", "##-Inf", "##NaN":
+		t = token.FLOAT
+	default:
+		t = token.ILLEGAL
+	}
+	return
+}
+
+// readChar reads the backslash and the character name, the first byte is
+// always taken so that \( and \; are characters as well.
+func (r *tokenReader) readChar() (t token.Token, err error) {
+	var b byte
+	r.buf.WriteByte('\\')
+	r.discardByte()
+	if b, err = r.nextByte(); err != nil {
+		if err == io.EOF {
+			err = incompletef(r.pos, "unexpected EOF after \\")
+		}
+		return
+	}
+	r.buf.WriteByte(b)
+	for {
+		b, err = r.peekByte()
+		if err != nil {
+			if err == io.EOF {
+				err = nil
+				break
+			}
+			return
+		}
+		if isDelimiter(b) {
+			break
+		}
+		r.discardByte()
+		r.buf.WriteByte(b)
+	}
+	t = token.CHAR
+	return
+}
+
 func (r *tokenReader) findSeqBytes() error {
 	for {
 		b, err := r.peekByte()
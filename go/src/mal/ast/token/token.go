@@ -14,16 +14,21 @@ const (
 	BOOL    // true/false
 	INT     // 12345
 	FLOAT   // 123.45
+	RATIO   // 3/4
 	STRING  // "abc"
 	KEYWORD // :abc
+	CHAR    // \a
+	REGEX   // #"abc"
 
 	// Delimiters
-	LPAREN // (
-	RPAREN // )
-	LBRACK // [
-	RBRACK // ]
-	LBRACE // {
-	RBRACE // }
+	LPAREN     // (
+	RPAREN     // )
+	LBRACK     // [
+	RBRACK     // ]
+	LBRACE     // {
+	RBRACE     // }
+	HASHLBRACE // #{
+	HASHLPAREN // #(
 
 	// Math functions
 	// ADD // +
@@ -31,13 +36,15 @@ const (
 	// MUL // *
 	// QUO // /
 
-	TILDEAT     // ~@
-	SINGLEQUOTE // '
-	BACKQUOTE   // `
-	TILDE       // ~
-	CIRCUMFLEX  // ^
-	ATSIGN      // @
-	ASNSCS      // [^\s\[\]{}()'"`@,;]+ a sequence of zero or more non special characters
+	TILDEAT        // ~@
+	SINGLEQUOTE    // '
+	BACKQUOTE      // `
+	TILDE          // ~
+	CIRCUMFLEX     // ^
+	ATSIGN         // @
+	HASHUNDERSCORE // #_
+	HASHQUESTION   // #?
+	ASNSCS         // [^\s\[\]{}()'"`@,;]+ a sequence of zero or more non special characters
 )
 
 type Pos struct {
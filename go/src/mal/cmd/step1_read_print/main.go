@@ -6,11 +6,15 @@ import (
 	"io"
 	"os"
 
+	"mal"
 	"mal/ast"
 )
 
+// features are selected by the reader conditionals, e.g. #?(:go 1 :clj 2).
+var features = []string{"go", "mal"}
+
 func READ(line string) (*ast.AST, error) {
-	a := new(ast.AST)
+	a := &ast.AST{Features: features}
 	err := a.Parse(line)
 	return a, err
 }
@@ -32,20 +36,59 @@ func REP(line string) error {
 	return nil
 }
 
+// readPiped prints the forms piped to the stdin as they arrive, instead of
+// prompting for them line by line.
+func readPiped() {
+	d := ast.NewDecoder(os.Stdin, features...)
+	for {
+		node, err := d.Decode()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERR: %v\n", err)
+			os.Exit(1)
+		}
+		switch node.(type) {
+		case *ast.Comment, *ast.Discard:
+			continue
+		}
+		fmt.Printf("%s\n", node)
+	}
+}
+
 func main() {
+	if !mal.IsTerminal() {
+		readPiped()
+		return
+	}
+
 	r := bufio.NewReader(os.Stdin)
+	prompt, input := "user> ", ""
+	var incomplete error
 	for {
-		fmt.Print("user> ")
+		fmt.Print(prompt)
 		line, err := r.ReadString('\n')
-		if err != nil {
+		if err != nil && !(err == io.EOF && line != "") {
 			if err == io.EOF {
+				if incomplete != nil {
+					fmt.Fprintf(os.Stderr, "ERR: %v\n", incomplete)
+					os.Exit(1)
+				}
 				break
 			}
 			fmt.Fprintf(os.Stderr, "ERR: %v\n", err)
 			return
 		}
-		if err := REP(line); err != nil {
+		input += line
+		if _, err := READ(input); ast.IsIncomplete(err) {
+			// Keep reading until the form is complete.
+			prompt, incomplete = "...> ", err
+			continue
+		}
+		if err := REP(input); err != nil {
 			fmt.Fprintf(os.Stderr, "ERR: %v\n", err)
 		}
+		prompt, input, incomplete = "user> ", "", nil
 	}
 }
@@ -11,8 +11,11 @@ import (
 	"mal/types"
 )
 
+// features are selected by the reader conditionals, e.g. #?(:go 1 :clj 2).
+var features = []string{"go", "mal"}
+
 func READ(line string) (*ast.AST, error) {
-	a := new(ast.AST)
+	a := &ast.AST{Features: features}
 	err := a.Parse(line)
 	return a, err
 }
@@ -40,22 +43,57 @@ func REP(line string, evaler *mal.Evaler) error {
 	return nil
 }
 
+// evalPiped evaluates the forms piped to the stdin as they arrive, instead
+// of prompting for them line by line.
+func evalPiped(evaler *mal.Evaler) {
+	err := evaler.EvalEach(mal.NewStdinDecoder(features...), func(v types.Valuer, err error) {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERR: %v\n", err)
+			return
+		}
+		PRINT([]types.Valuer{v})
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERR: %v\n", err)
+		os.Exit(1)
+	}
+}
+
 func main() {
 	evaler := mal.NewEvaler(mal.NewEnv(nil, nil, nil))
+	evaler.SetFeatures(features...)
+
+	if !mal.IsTerminal() {
+		evalPiped(evaler)
+		return
+	}
 
 	r := bufio.NewReader(os.Stdin)
+	prompt, input := "user> ", ""
+	var incomplete error
 	for {
-		fmt.Print("user> ")
+		fmt.Print(prompt)
 		line, err := r.ReadString('\n')
-		if err != nil {
+		if err != nil && !(err == io.EOF && line != "") {
 			if err == io.EOF {
+				if incomplete != nil {
+					fmt.Fprintf(os.Stderr, "ERR: %v\n", incomplete)
+					os.Exit(1)
+				}
 				break
 			}
 			fmt.Fprintf(os.Stderr, "ERR: %v\n", err)
 			return
 		}
-		if err := REP(line, evaler); err != nil {
+		input += line
+		if _, err := READ(input); ast.IsIncomplete(err) {
+			// Keep reading until the form is complete.
+			prompt, incomplete = "...> ", err
+			continue
+		}
+		if err := REP(input, evaler); err != nil {
 			fmt.Fprintf(os.Stderr, "ERR: %v\n", err)
 		}
+		prompt, input, incomplete = "user> ", "", nil
 	}
 }
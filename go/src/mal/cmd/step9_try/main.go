@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+
+	"mal"
+	"mal/ast"
+	"mal/types"
+)
+
+var prelude = []string{
+	"(def! not (fn* (a) (if a false true)))",
+	`(defmacro! cond (fn* (& xs) (if (> (count xs) 0) (list 'if (first xs) (if (> (count xs) 1) (nth xs 1) (throw "odd number of forms to cond")) (cons 'cond (rest (rest xs)))))))`,
+	"(defmacro! or (fn* (& xs) (if (empty? xs) nil (if (= 1 (count xs)) (first xs) `(let* (or_FIXME ~(first xs)) (if or_FIXME or_FIXME (or ~@(rest xs))))))))",
+}
+
+// features are selected by the reader conditionals, e.g. #?(:go 1 :clj 2).
+var features = []string{"go", "mal"}
+
+func READ(line string) (*ast.AST, error) {
+	a := &ast.AST{Features: features}
+	err := a.Parse(line)
+	return a, err
+}
+
+func EVAL(a *ast.AST, evaler *mal.Evaler) ([]types.Valuer, error) {
+	return evaler.EvalAST(a)
+}
+
+func PRINT(vs []types.Valuer) {
+	for _, v := range vs {
+		fmt.Println(v.SPrint(true))
+	}
+}
+
+func RE(line string, evaler *mal.Evaler) ([]types.Valuer, error) {
+	a, err := READ(line)
+	if err != nil {
+		return nil, err
+	}
+	return EVAL(a, evaler)
+}
+
+func REP(line string, evaler *mal.Evaler) error {
+	vs, err := RE(line, evaler)
+	if err != nil {
+		return err
+	}
+	PRINT(vs)
+	return nil
+}
+
+// evalPiped evaluates the forms piped to the stdin as they arrive, instead
+// of prompting for them line by line.
+func evalPiped(evaler *mal.Evaler) {
+	err := evaler.EvalEach(mal.NewStdinDecoder(features...), func(v types.Valuer, err error) {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERR: %v\n", err)
+			return
+		}
+		PRINT([]types.Valuer{v})
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERR: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func main() {
+	args := []types.Valuer{}
+	if len(os.Args) > 2 {
+		for _, arg := range os.Args[2:] {
+			args = append(args, types.String(arg))
+		}
+	}
+	argv := types.NewList(args...)
+	env := mal.NewEnv(nil, nil, nil)
+	env.Set("*ARGV*", argv)
+	evaler := mal.NewEvaler(env)
+	evaler.SetFeatures(features...)
+	for _, code := range prelude {
+		if _, err := RE(code, evaler); err != nil {
+			fmt.Fprintf(os.Stderr, "ERR(prelude): %v\n", err)
+			return
+		}
+	}
+
+	if len(os.Args) > 1 {
+		if _, err := RE(fmt.Sprintf("(load-file %q)", os.Args[1]), evaler); err != nil {
+			fmt.Fprintf(os.Stderr, "ERR: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if !mal.IsTerminal() {
+		evalPiped(evaler)
+		return
+	}
+
+	r := bufio.NewReader(os.Stdin)
+	prompt, input := "user> ", ""
+	var incomplete error
+	for {
+		fmt.Print(prompt)
+		line, err := r.ReadString('\n')
+		if err != nil && !(err == io.EOF && line != "") {
+			if err == io.EOF {
+				if incomplete != nil {
+					fmt.Fprintf(os.Stderr, "ERR: %v\n", incomplete)
+					os.Exit(1)
+				}
+				break
+			}
+			fmt.Fprintf(os.Stderr, "ERR: %v\n", err)
+			return
+		}
+		input += line
+		if _, err := READ(input); ast.IsIncomplete(err) {
+			// Keep reading until the form is complete, the errors of
+			// read-string and load-file are reported by REP.
+			prompt, incomplete = "...> ", err
+			continue
+		}
+		if err := REP(input, evaler); err != nil {
+			fmt.Fprintf(os.Stderr, "ERR: %v\n", err)
+		}
+		prompt, input, incomplete = "user> ", "", nil
+	}
+}
@@ -2,66 +2,193 @@ package mal
 
 import (
 	"fmt"
+	"io"
+	"io/ioutil"
+	"mal/ast"
+	"mal/ast/token"
 	"mal/types"
+	"os"
 	"strings"
+	"time"
+	"unicode/utf8"
 )
 
-// FIXME(damnever): check arg number/type???????
-
-var funcmap = map[string]types.FuncType{
-	"+":       funcAdd,
-	"-":       funcSub,
-	"*":       funcMul,
-	"/":       funcDiv,
-	"<":       funcLess,
-	"<=":      funcLessOrEqual,
-	">":       funcGreater,
-	">=":      funcGreaterOrEqual,
-	"=":       funcIsEqual,
-	"list":    funcToList,
-	"list?":   funcIsList,
-	"empty?":  funcIsEmpty,
-	"count":   funcCount,
-	"prn":     funcPrint,
-	"pr-str":  funcPrintStr,
-	"str":     funcStr,
-	"println": funcPrintln,
+type coreFunc struct {
+	spec funcSpec
+	fn   types.FuncType
+}
+
+var funcmap = map[string]coreFunc{
+	"+":       {variadic(numberArg, numberArg, numberArg), funcAdd},
+	"-":       {variadic(numberArg, numberArg, numberArg), funcSub},
+	"*":       {variadic(numberArg, numberArg, numberArg), funcMul},
+	"/":       {variadic(numberArg, numberArg, numberArg), funcDiv},
+	"<":       {variadic(numberArg, numberArg, numberArg), funcLess},
+	"<=":      {variadic(numberArg, numberArg, numberArg), funcLessOrEqual},
+	">":       {variadic(numberArg, numberArg, numberArg), funcGreater},
+	">=":      {variadic(numberArg, numberArg, numberArg), funcGreaterOrEqual},
+	"=":       {arity(anyArg, anyArg), funcIsEqual},
+	"list":    {variadic(anyArg), funcToList},
+	"list?":   {arity(anyArg), funcIsList},
+	"empty?":  {arity(anyArg), funcIsEmpty},
+	"count":   {arity(anyArg), funcCount},
+	"prn":     {variadic(anyArg), funcPrint},
+	"pr-str":  {variadic(anyArg), funcPrintStr},
+	"str":     {variadic(anyArg), funcStr},
+	"println": {variadic(anyArg), funcPrintln},
+
+	"slurp": {arity(stringArg), funcSlurp},
+
+	"atom":   {arity(anyArg), funcAtom},
+	"atom?":  {arity(anyArg), funcIsAtom},
+	"deref":  {arity(atomArg), funcDeref},
+	"reset!": {arity(atomArg, anyArg), funcReset},
+
+	"cons":   {arity(anyArg, seqArg), funcCons},
+	"concat": {variadic(seqArg), funcConcat},
+	"vec":    {arity(seqArg), funcVec},
+
+	"nth":   {arity(seqArg, intArg), funcNth},
+	"first": {arity(seqArg), funcFirst},
+	"rest":  {arity(seqArg), funcRest},
+
+	"throw": {arity(anyArg), funcThrow},
+
+	"nil?":        {arity(anyArg), funcIsNil},
+	"true?":       {arity(anyArg), funcIsTrue},
+	"false?":      {arity(anyArg), funcIsFalse},
+	"symbol":      {arity(stringArg), funcSymbol},
+	"symbol?":     {arity(anyArg), funcIsSymbol},
+	"keyword":     {arity(stringOrKeywordArg), funcKeyword},
+	"keyword?":    {arity(anyArg), funcIsKeyword},
+	"vector":      {variadic(anyArg), funcVector},
+	"vector?":     {arity(anyArg), funcIsVector},
+	"sequential?": {arity(anyArg), funcIsSequential},
+
+	"hash-map":  {variadic(anyArg), funcHashMap},
+	"map?":      {arity(anyArg), funcIsMap},
+	"assoc":     {variadic(anyArg, mapArg), funcAssoc},
+	"dissoc":    {variadic(anyArg, mapArg), funcDissoc},
+	"get":       {arity(mapOrNilArg, anyArg), funcGet},
+	"contains?": {arity(mapSetOrNilArg, anyArg), funcContains},
+	"keys":      {arity(mapOrNilArg), funcKeys},
+	"vals":      {arity(mapOrNilArg), funcVals},
+
+	"set":          {arity(seqOrSetArg), funcSet},
+	"set?":         {arity(anyArg), funcIsSet},
+	"disj":         {variadic(anyArg, setArg), funcDisj},
+	"union":        {variadic(setArg, setArg), funcUnion},
+	"intersection": {variadic(setArg, setArg), funcIntersection},
+	"difference":   {variadic(setArg, setArg), funcDifference},
+
+	"readline":  {arity(stringArg), funcReadline},
+	"time-ms":   {arity(), funcTimeMs},
+	"meta":      {arity(anyArg), funcMeta},
+	"with-meta": {arity(anyArg, anyArg), funcWithMeta},
+	"seq":       {arity(seqableArg), funcSeq},
+	"conj":      {variadic(anyArg, collArg), funcConj},
+	"string?":   {arity(anyArg), funcIsString},
+	"number?":   {arity(anyArg), funcIsNumber},
+	"inf?":      {arity(numberArg), funcIsInf},
+	"nan?":      {arity(numberArg), funcIsNaN},
+	"fn?":       {arity(anyArg), funcIsFn},
+	"macro?":    {arity(anyArg), funcIsMacro},
+
+	"char?": {arity(anyArg), funcIsChar},
+	"char":  {arity(intArg), funcChar},
+	"int":   {arity(charOrNumberArg), funcInt},
+
+	"string-from-chars": {arity(seqArg), funcStringFromChars},
+
+	"re-pattern": {arity(stringArg), funcRePattern},
+	"re-find":    {arity(regexArg, stringArg), funcReFind},
+	"re-matches": {arity(regexArg, stringArg), funcReMatches},
+}
+
+// constmap contains the values bound in the root environment.
+var constmap = map[string]types.Valuer{
+	"*inf*":  types.Inf,
+	"*-inf*": types.NegInf,
+	"*nan*":  types.NaN,
+}
+
+type evalCoreFunc struct {
+	spec funcSpec
+	fn   func(*Evaler, ...types.Valuer) (types.Valuer, error)
+}
+
+// evalfuncmap contains the functions which need the evaler to evaluate code,
+// call functions or read code with its features, they are always evaluated
+// within the root environment.
+var evalfuncmap = map[string]evalCoreFunc{
+	"eval":        {arity(anyArg), funcEval},
+	"load-file":   {arity(stringArg), funcLoadFile},
+	"read-string": {arity(stringArg), funcReadString},
+
+	"swap!": {variadic(anyArg, atomArg, fnArg), funcSwap},
+	"apply": {variadic(anyArg, fnArg, anyArg), funcApply},
+	"map":   {arity(fnArg, seqArg), funcMap},
 }
 
 func funcAdd(vs ...types.Valuer) (types.Valuer, error) {
-	return vs[0].(types.Number).Add(vs[1].(types.Number)), nil
+	return reduceNumbers(vs, types.Number.Add)
 }
 
 func funcSub(vs ...types.Valuer) (types.Valuer, error) {
-	return vs[0].(types.Number).Sub(vs[1].(types.Number)), nil
+	return reduceNumbers(vs, types.Number.Sub)
 }
 
 func funcMul(vs ...types.Valuer) (types.Valuer, error) {
-	return vs[0].(types.Number).Mul(vs[1].(types.Number)), nil
+	return reduceNumbers(vs, types.Number.Mul)
 }
 
 func funcDiv(vs ...types.Valuer) (types.Valuer, error) {
-	return vs[0].(types.Number).Div(vs[1].(types.Number)), nil
+	return reduceNumbers(vs, types.Number.Div)
+}
+
+func reduceNumbers(vs []types.Valuer, op func(types.Number, types.Number) (types.Number, error)) (types.Valuer, error) {
+	r := vs[0].(types.Number)
+	for _, v := range vs[1:] {
+		var err error
+		if r, err = op(r, v.(types.Number)); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
 }
 
 func funcLess(vs ...types.Valuer) (types.Valuer, error) {
-	r := vs[0].(types.Number).Compare(vs[1].(types.Number)) < 0
-	return types.Bool(r), nil
+	return compareNumbers(vs, func(r int) bool { return r < 0 })
 }
 
 func funcLessOrEqual(vs ...types.Valuer) (types.Valuer, error) {
-	r := vs[0].(types.Number).Compare(vs[1].(types.Number)) <= 0
-	return types.Bool(r), nil
+	return compareNumbers(vs, func(r int) bool { return r <= 0 })
 }
 
 func funcGreater(vs ...types.Valuer) (types.Valuer, error) {
-	r := vs[0].(types.Number).Compare(vs[1].(types.Number)) > 0
-	return types.Bool(r), nil
+	return compareNumbers(vs, func(r int) bool { return r > 0 })
 }
 
 func funcGreaterOrEqual(vs ...types.Valuer) (types.Valuer, error) {
-	r := vs[0].(types.Number).Compare(vs[1].(types.Number)) >= 0
-	return types.Bool(r), nil
+	return compareNumbers(vs, func(r int) bool { return r >= 0 })
+}
+
+// compareNumbers checks whether every adjacent pair satisfies ok, NaN is
+// unordered so any comparison with it is false.
+func compareNumbers(vs []types.Valuer, ok func(int) bool) (types.Valuer, error) {
+	for i := 1; i < len(vs); i++ {
+		if isNaN(vs[i-1]) || isNaN(vs[i]) {
+			return types.Bool(false), nil
+		}
+		r, err := vs[i-1].(types.Number).Compare(vs[i].(types.Number))
+		if err != nil {
+			return nil, err
+		}
+		if !ok(r) {
+			return types.Bool(false), nil
+		}
+	}
+	return types.Bool(true), nil
 }
 
 func funcPrint(vs ...types.Valuer) (types.Valuer, error) {
@@ -99,11 +226,7 @@ func funcprint(sep string, readable bool, vs ...types.Valuer) (types.Valuer, err
 }
 
 func funcToList(vs ...types.Valuer) (types.Valuer, error) {
-	l := types.NewList()
-	for _, v := range vs {
-		l.PushBack(v)
-	}
-	return l, nil
+	return types.NewList(vs...), nil
 }
 
 func funcIsList(vs ...types.Valuer) (types.Valuer, error) {
@@ -117,6 +240,10 @@ func funcIsEmpty(vs ...types.Valuer) (types.Valuer, error) {
 		return types.Bool(x.Len() == 0), nil
 	case *types.Vector:
 		return types.Bool(x.Len() == 0), nil
+	case types.Set:
+		return types.Bool(x.Len() == 0), nil
+	case types.Map:
+		return types.Bool(x.Len() == 0), nil
 	default:
 	}
 	return types.Bool(false), nil
@@ -128,6 +255,10 @@ func funcCount(vs ...types.Valuer) (types.Valuer, error) {
 		return types.Int(x.Len()), nil
 	case *types.Vector:
 		return types.Int(x.Len()), nil
+	case types.Set:
+		return types.Int(x.Len()), nil
+	case types.Map:
+		return types.Int(x.Len()), nil
 	default:
 	}
 	return types.Int(0), nil
@@ -136,3 +267,551 @@ func funcCount(vs ...types.Valuer) (types.Valuer, error) {
 func funcIsEqual(vs ...types.Valuer) (types.Valuer, error) {
 	return types.Bool(vs[0].IsEqaulTo(vs[1])), nil
 }
+
+// funcReadString reads the first form only.
+func funcReadString(e *Evaler, vs ...types.Valuer) (types.Valuer, error) {
+	d := ast.NewDecoder(strings.NewReader(string(vs[0].(types.String))), e.features...)
+	for {
+		node, err := d.Decode()
+		if err == io.EOF {
+			return types.Nil{}, nil
+		}
+		if err != nil {
+			return nil, readerError(err)
+		}
+		v, err := nodeToValue(node)
+		if err != errIgnore {
+			return v, err
+		}
+	}
+}
+
+func funcSlurp(vs ...types.Valuer) (types.Valuer, error) {
+	data, err := ioutil.ReadFile(string(vs[0].(types.String)))
+	if err != nil {
+		return nil, err
+	}
+	return types.String(data), nil
+}
+
+func funcEval(e *Evaler, vs ...types.Valuer) (types.Valuer, error) {
+	return e.evalNode(valueToNode(vs[0], token.Pos{}))
+}
+
+// funcLoadFile evaluates the forms as they are read from the file.
+func funcLoadFile(e *Evaler, vs ...types.Valuer) (types.Valuer, error) {
+	f, err := os.Open(string(vs[0].(types.String)))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	v, err := e.EvalDecoder(ast.NewDecoder(f, e.features...))
+	return v, readerError(err)
+}
+
+func funcAtom(vs ...types.Valuer) (types.Valuer, error) {
+	return types.NewAtom(vs[0]), nil
+}
+
+func funcIsAtom(vs ...types.Valuer) (types.Valuer, error) {
+	_, ok := vs[0].(*types.Atom)
+	return types.Bool(ok), nil
+}
+
+func funcDeref(vs ...types.Valuer) (types.Valuer, error) {
+	return vs[0].(*types.Atom).Value, nil
+}
+
+func funcReset(vs ...types.Valuer) (types.Valuer, error) {
+	a := vs[0].(*types.Atom)
+	a.Value = vs[1]
+	return a.Value, nil
+}
+
+func funcSwap(e *Evaler, vs ...types.Valuer) (types.Valuer, error) {
+	a := vs[0].(*types.Atom)
+	args := append([]types.Valuer{a.Value}, vs[2:]...)
+	v, err := e.applyFunc(vs[1], args...)
+	if err != nil {
+		return nil, err
+	}
+	a.Value = v
+	return v, nil
+}
+
+// sequence returns the elements of list or vector, nil for others.
+func sequence(v types.Valuer) []types.Valuer {
+	switch x := v.(type) {
+	case types.List:
+		return x.Elems()
+	case *types.Vector:
+		return x.Elems()
+	case types.Set:
+		return x.Elems()
+	}
+	return nil
+}
+
+func funcCons(vs ...types.Valuer) (types.Valuer, error) {
+	if l, ok := vs[1].(types.List); ok {
+		return l.Cons(vs[0]), nil
+	}
+	return types.NewList(append([]types.Valuer{vs[0]}, sequence(vs[1])...)...), nil
+}
+
+// funcConcat shares the last list instead of copying it.
+func funcConcat(vs ...types.Valuer) (types.Valuer, error) {
+	if len(vs) == 0 {
+		return types.NewList(), nil
+	}
+	l, ok := vs[len(vs)-1].(types.List)
+	if !ok {
+		l = types.NewList(sequence(vs[len(vs)-1])...)
+	}
+	for i := len(vs) - 2; i >= 0; i-- {
+		elems := sequence(vs[i])
+		for j := len(elems) - 1; j >= 0; j-- {
+			l = l.Cons(elems[j])
+		}
+	}
+	return l.WithMeta(nil), nil
+}
+
+func funcVec(vs ...types.Valuer) (types.Valuer, error) {
+	return types.NewVector(sequence(vs[0])...), nil
+}
+
+func funcNth(vs ...types.Valuer) (types.Valuer, error) {
+	i := int(vs[1].(types.Int))
+	switch x := vs[0].(type) {
+	case types.List:
+		if i >= 0 && i < x.Len() {
+			for ; i > 0; i-- {
+				x = x.Rest()
+			}
+			return x.First(), nil
+		}
+	case *types.Vector:
+		if i >= 0 && i < x.Len() {
+			return x.Nth(i), nil
+		}
+	}
+	return nil, fmt.Errorf("nth: index %d out of range", i)
+}
+
+func funcFirst(vs ...types.Valuer) (types.Valuer, error) {
+	switch x := vs[0].(type) {
+	case types.List:
+		return x.First(), nil
+	case *types.Vector:
+		if x.Len() > 0 {
+			return x.Nth(0), nil
+		}
+	}
+	return types.Nil{}, nil
+}
+
+func funcRest(vs ...types.Valuer) (types.Valuer, error) {
+	switch x := vs[0].(type) {
+	case types.List:
+		return x.Rest(), nil
+	case *types.Vector:
+		if elems := x.Elems(); len(elems) > 0 {
+			return types.NewList(elems[1:]...), nil
+		}
+	}
+	return types.NewList(), nil
+}
+
+func funcThrow(vs ...types.Valuer) (types.Valuer, error) {
+	return nil, &Exception{Value: vs[0]}
+}
+
+func funcApply(e *Evaler, vs ...types.Valuer) (types.Valuer, error) {
+	n := len(vs)
+	if !seqArg.check(vs[n-1]) {
+		return nil, fmt.Errorf("apply: expected %s as the last argument, got %s", seqArg.name, typeName(vs[n-1]))
+	}
+	args := append([]types.Valuer{}, vs[1:n-1]...)
+	args = append(args, sequence(vs[n-1])...)
+	return e.applyFunc(vs[0], args...)
+}
+
+func funcMap(e *Evaler, vs ...types.Valuer) (types.Valuer, error) {
+	elems := sequence(vs[1])
+	for i, elem := range elems {
+		v, err := e.applyFunc(vs[0], elem)
+		if err != nil {
+			return nil, err
+		}
+		elems[i] = v
+	}
+	return types.NewList(elems...), nil
+}
+
+func funcIsNil(vs ...types.Valuer) (types.Valuer, error) {
+	_, ok := vs[0].(types.Nil)
+	return types.Bool(ok), nil
+}
+
+func funcIsTrue(vs ...types.Valuer) (types.Valuer, error) {
+	b, ok := vs[0].(types.Bool)
+	return types.Bool(ok && bool(b)), nil
+}
+
+func funcIsFalse(vs ...types.Valuer) (types.Valuer, error) {
+	b, ok := vs[0].(types.Bool)
+	return types.Bool(ok && !bool(b)), nil
+}
+
+func funcSymbol(vs ...types.Valuer) (types.Valuer, error) {
+	return types.Symbol(vs[0].(types.String)), nil
+}
+
+func funcIsSymbol(vs ...types.Valuer) (types.Valuer, error) {
+	_, ok := vs[0].(types.Symbol)
+	return types.Bool(ok), nil
+}
+
+func funcKeyword(vs ...types.Valuer) (types.Valuer, error) {
+	if k, ok := vs[0].(types.Keyword); ok {
+		return k, nil
+	}
+	return types.Keyword(vs[0].(types.String)), nil
+}
+
+func funcIsKeyword(vs ...types.Valuer) (types.Valuer, error) {
+	_, ok := vs[0].(types.Keyword)
+	return types.Bool(ok), nil
+}
+
+func funcVector(vs ...types.Valuer) (types.Valuer, error) {
+	return types.NewVector(vs...), nil
+}
+
+func funcIsVector(vs ...types.Valuer) (types.Valuer, error) {
+	_, ok := vs[0].(*types.Vector)
+	return types.Bool(ok), nil
+}
+
+func funcIsSequential(vs ...types.Valuer) (types.Valuer, error) {
+	switch vs[0].(type) {
+	case types.List, *types.Vector:
+		return types.Bool(true), nil
+	}
+	return types.Bool(false), nil
+}
+
+func funcHashMap(vs ...types.Valuer) (types.Valuer, error) {
+	return funcAssoc(append([]types.Valuer{types.NewMap()}, vs...)...)
+}
+
+func funcIsMap(vs ...types.Valuer) (types.Valuer, error) {
+	_, ok := vs[0].(types.Map)
+	return types.Bool(ok), nil
+}
+
+func funcAssoc(vs ...types.Valuer) (types.Valuer, error) {
+	if len(vs)%2 != 1 {
+		return nil, fmt.Errorf("assoc: key/value pair required")
+	}
+	m := vs[0].(types.Map)
+	for i := 1; i < len(vs); i += 2 {
+		k, ok := vs[i].(types.MapKey)
+		if !ok {
+			return nil, fmt.Errorf("assoc: invalid map key: %s", vs[i].SPrint(true))
+		}
+		m.Set(k, vs[i+1])
+	}
+	return m, nil
+}
+
+func funcDissoc(vs ...types.Valuer) (types.Valuer, error) {
+	m := vs[0].(types.Map)
+	for _, k := range vs[1:] {
+		m = m.Dissoc(k)
+	}
+	return m, nil
+}
+
+func funcGet(vs ...types.Valuer) (types.Valuer, error) {
+	if m, ok := vs[0].(types.Map); ok {
+		if v, ok := m.Get(vs[1]); ok {
+			return v, nil
+		}
+	}
+	return types.Nil{}, nil
+}
+
+func funcContains(vs ...types.Valuer) (types.Valuer, error) {
+	switch x := vs[0].(type) {
+	case types.Map:
+		_, ok := x.Get(vs[1])
+		return types.Bool(ok), nil
+	case types.Set:
+		return types.Bool(x.Contains(vs[1])), nil
+	}
+	return types.Bool(false), nil
+}
+
+func funcKeys(vs ...types.Valuer) (types.Valuer, error) {
+	if m, ok := vs[0].(types.Map); ok {
+		return types.NewList(m.Keys()...), nil
+	}
+	return types.NewList(), nil
+}
+
+func funcVals(vs ...types.Valuer) (types.Valuer, error) {
+	if m, ok := vs[0].(types.Map); ok {
+		return types.NewList(m.Vals()...), nil
+	}
+	return types.NewList(), nil
+}
+
+func funcReadline(vs ...types.Valuer) (types.Valuer, error) {
+	line, err := Readline(string(vs[0].(types.String)))
+	if err != nil {
+		if err == io.EOF {
+			return types.Nil{}, nil
+		}
+		return nil, err
+	}
+	return types.String(line), nil
+}
+
+func funcTimeMs(vs ...types.Valuer) (types.Valuer, error) {
+	return types.Int(time.Now().UnixNano() / int64(time.Millisecond)), nil
+}
+
+func funcMeta(vs ...types.Valuer) (types.Valuer, error) {
+	if x, ok := vs[0].(types.Metadata); ok {
+		return x.Meta(), nil
+	}
+	return types.Nil{}, nil
+}
+
+func funcWithMeta(vs ...types.Valuer) (types.Valuer, error) {
+	x, ok := vs[0].(types.Metadata)
+	if !ok {
+		return nil, fmt.Errorf("with-meta: metadata is not supported by %s", vs[0].SPrint(true))
+	}
+	return x.WithMeta(vs[1]), nil
+}
+
+func funcSeq(vs ...types.Valuer) (types.Valuer, error) {
+	var elems []types.Valuer
+	switch x := vs[0].(type) {
+	case types.String:
+		for _, r := range string(x) {
+			elems = append(elems, types.Char(r))
+		}
+	default:
+		elems = sequence(x)
+	}
+	if len(elems) == 0 {
+		return types.Nil{}, nil
+	}
+	return types.NewList(elems...), nil
+}
+
+func funcConj(vs ...types.Valuer) (types.Valuer, error) {
+	switch x := vs[0].(type) {
+	case types.List:
+		l := x
+		for _, v := range vs[1:] {
+			l = l.Cons(v)
+		}
+		return l.WithMeta(x.Meta()), nil
+	case types.Set:
+		for _, v := range vs[1:] {
+			k, ok := v.(types.MapKey)
+			if !ok {
+				return nil, fmt.Errorf("conj: invalid set element: %s", v.SPrint(true))
+			}
+			x = x.Conj(k)
+		}
+		return x, nil
+	case *types.Vector:
+		for _, v := range vs[1:] {
+			x = x.Conj(v)
+		}
+		return x, nil
+	}
+	return nil, fmt.Errorf("conj: expect list or vector, got %s", vs[0].SPrint(true))
+}
+
+func funcIsString(vs ...types.Valuer) (types.Valuer, error) {
+	_, ok := vs[0].(types.String)
+	return types.Bool(ok), nil
+}
+
+func funcIsNumber(vs ...types.Valuer) (types.Valuer, error) {
+	_, ok := vs[0].(types.Number)
+	return types.Bool(ok), nil
+}
+
+func funcIsInf(vs ...types.Valuer) (types.Valuer, error) {
+	f, ok := vs[0].(types.Float)
+	return types.Bool(ok && f.IsInf()), nil
+}
+
+func funcIsNaN(vs ...types.Valuer) (types.Valuer, error) {
+	return types.Bool(isNaN(vs[0])), nil
+}
+
+func isNaN(v types.Valuer) bool {
+	f, ok := v.(types.Float)
+	return ok && f.IsNaN()
+}
+
+func funcIsFn(vs ...types.Valuer) (types.Valuer, error) {
+	switch x := vs[0].(type) {
+	case types.Func:
+		return types.Bool(true), nil
+	case types.LambdaFunc:
+		return types.Bool(!x.IsMacro), nil
+	}
+	return types.Bool(false), nil
+}
+
+func funcIsMacro(vs ...types.Valuer) (types.Valuer, error) {
+	fn, ok := vs[0].(types.LambdaFunc)
+	return types.Bool(ok && fn.IsMacro), nil
+}
+
+func funcSet(vs ...types.Valuer) (types.Valuer, error) {
+	if s, ok := vs[0].(types.Set); ok {
+		return s.WithMeta(nil), nil
+	}
+	s := types.NewSet()
+	for _, v := range sequence(vs[0]) {
+		k, ok := v.(types.MapKey)
+		if !ok {
+			return nil, fmt.Errorf("set: invalid set element: %s", v.SPrint(true))
+		}
+		s = s.Conj(k)
+	}
+	return s, nil
+}
+
+func funcIsSet(vs ...types.Valuer) (types.Valuer, error) {
+	_, ok := vs[0].(types.Set)
+	return types.Bool(ok), nil
+}
+
+func funcDisj(vs ...types.Valuer) (types.Valuer, error) {
+	s := vs[0].(types.Set)
+	for _, v := range vs[1:] {
+		s = s.Disj(v)
+	}
+	return s, nil
+}
+
+func funcUnion(vs ...types.Valuer) (types.Valuer, error) {
+	s := vs[0].(types.Set)
+	for _, v := range vs[1:] {
+		for _, elem := range v.(types.Set).Elems() {
+			s = s.Conj(elem.(types.MapKey))
+		}
+	}
+	return s, nil
+}
+
+func funcIntersection(vs ...types.Valuer) (types.Valuer, error) {
+	s := vs[0].(types.Set)
+	for _, elem := range s.Elems() {
+		for _, v := range vs[1:] {
+			if !v.(types.Set).Contains(elem) {
+				s = s.Disj(elem)
+				break
+			}
+		}
+	}
+	return s, nil
+}
+
+func funcDifference(vs ...types.Valuer) (types.Valuer, error) {
+	s := vs[0].(types.Set)
+	for _, v := range vs[1:] {
+		for _, elem := range v.(types.Set).Elems() {
+			s = s.Disj(elem)
+		}
+	}
+	return s, nil
+}
+
+func funcIsChar(vs ...types.Valuer) (types.Valuer, error) {
+	_, ok := vs[0].(types.Char)
+	return types.Bool(ok), nil
+}
+
+func funcChar(vs ...types.Valuer) (types.Valuer, error) {
+	r := vs[0].(types.Int)
+	if r < 0 || r > utf8.MaxRune || !utf8.ValidRune(rune(r)) {
+		return nil, fmt.Errorf("char: invalid code point %d", r)
+	}
+	return types.Char(r), nil
+}
+
+func funcInt(vs ...types.Valuer) (types.Valuer, error) {
+	if c, ok := vs[0].(types.Char); ok {
+		return types.Int(c), nil
+	}
+	n, err := types.Truncate(vs[0].(types.Number))
+	if err != nil {
+		return nil, fmt.Errorf("int: %v", err)
+	}
+	return n, nil
+}
+
+func funcStringFromChars(vs ...types.Valuer) (types.Valuer, error) {
+	var b strings.Builder
+	for i, v := range sequence(vs[0]) {
+		c, ok := v.(types.Char)
+		if !ok {
+			return nil, fmt.Errorf("string-from-chars: expected char at index %d, got %s", i, typeName(v))
+		}
+		b.WriteRune(rune(c))
+	}
+	return types.String(b.String()), nil
+}
+
+func funcRePattern(vs ...types.Valuer) (types.Valuer, error) {
+	re, err := types.NewRegex(string(vs[0].(types.String)))
+	if err != nil {
+		return nil, fmt.Errorf("re-pattern: %v", err)
+	}
+	return re, nil
+}
+
+// funcReFind returns the first match, or a vector of the match and its
+// groups if the regex has any.
+func funcReFind(vs ...types.Valuer) (types.Valuer, error) {
+	re := vs[0].(types.Regex).Regexp()
+	s := string(vs[1].(types.String))
+	return matchValue(re.FindStringSubmatchIndex(s), s), nil
+}
+
+// funcReMatches is like re-find but the whole string must match.
+func funcReMatches(vs ...types.Valuer) (types.Valuer, error) {
+	s := string(vs[1].(types.String))
+	return matchValue(vs[0].(types.Regex).MatchWhole(s), s), nil
+}
+
+func matchValue(loc []int, s string) types.Valuer {
+	if loc == nil {
+		return types.Nil{}
+	}
+	if len(loc) == 2 {
+		return types.String(s[loc[0]:loc[1]])
+	}
+	groups := []types.Valuer{}
+	for i := 0; i < len(loc); i += 2 {
+		if loc[i] < 0 {
+			groups = append(groups, types.Nil{})
+		} else {
+			groups = append(groups, types.String(s[loc[i]:loc[i+1]]))
+		}
+	}
+	return types.NewVector(groups...)
+}
@@ -16,19 +16,44 @@ func NewEnv(outer *Env, binds []string, exprs []types.Valuer) *Env {
 		data:  map[string]types.Valuer{},
 	}
 
+	// The missing exprs are bound to nil, callers should check them first.
 	for i, b := range binds {
 		if b == "&" {
 			l := types.NewList()
-			l.Append(exprs[i:]...)
-			env.Set(binds[i+1], l)
+			if i < len(exprs) {
+				l = types.NewList(exprs[i:]...)
+			}
+			if i+1 < len(binds) {
+				env.Set(binds[i+1], l)
+			}
 			break
 		}
-		env.Set(b, exprs[i])
+		if i < len(exprs) {
+			env.Set(b, exprs[i])
+		} else {
+			env.Set(b, types.Nil{})
+		}
 	}
 
 	return env
 }
 
+// checkBinds checks whether the number of exprs matches the binds of fn.
+func checkBinds(fn types.LambdaFunc, exprs []types.Valuer) error {
+	for i, b := range fn.Binds {
+		if b == "&" {
+			if len(exprs) < i {
+				return fmt.Errorf("%s: expected at least %s, got %d", fn.SPrint(true), arguments(i), len(exprs))
+			}
+			return nil
+		}
+	}
+	if n := len(fn.Binds); len(exprs) != n {
+		return fmt.Errorf("%s: expected %s, got %d", fn.SPrint(true), arguments(n), len(exprs))
+	}
+	return nil
+}
+
 func (e *Env) Set(symbol string, value types.Valuer) {
 	e.data[symbol] = value
 }
@@ -36,7 +61,7 @@ func (e *Env) Set(symbol string, value types.Valuer) {
 func (e *Env) Get(symbol string) (types.Valuer, error) {
 	v, ok := e.Find(symbol)
 	if !ok {
-		return nil, fmt.Errorf("symbol(%s) not found", symbol)
+		return nil, fmt.Errorf("'%s' not found", symbol)
 	}
 	return v, nil
 }
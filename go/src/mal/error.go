@@ -0,0 +1,77 @@
+package mal
+
+import (
+	"errors"
+	"fmt"
+
+	"mal/ast"
+	"mal/ast/token"
+	"mal/types"
+)
+
+// Exception is the error thrown by throw, it carries an arbitrary value.
+type Exception struct {
+	Value types.Valuer
+}
+
+func (e *Exception) Error() string {
+	return e.Value.SPrint(true)
+}
+
+// Error attaches the position of the form which causes the error.
+type Error struct {
+	Pos token.Pos
+	Err error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("[%s] %v", e.Pos, e.Err)
+}
+
+func errorf(pos token.Pos, format string, args ...interface{}) error {
+	return &Error{Pos: pos, Err: fmt.Errorf(format, args...)}
+}
+
+// withPos attaches pos to err unless it already has one.
+func withPos(pos token.Pos, err error) error {
+	switch err.(type) {
+	case nil, *Error:
+		return err
+	}
+	if err == errIgnore {
+		return err
+	}
+	return &Error{Pos: pos, Err: err}
+}
+
+// readerError converts the errors of the reader raised by read-string and
+// load-file into *Error, so the REPL doesn't take an incomplete form read at
+// runtime for its own incomplete input.
+func readerError(err error) error {
+	switch e := err.(type) {
+	case *ast.SyntaxError:
+		return &Error{Pos: e.Pos, Err: errors.New(e.Msg)}
+	case *ast.IncompleteError:
+		return &Error{Pos: e.Pos, Err: errors.New(e.Msg)}
+	}
+	return err
+}
+
+// recoverError converts the panic into *Error at pos, it must be deferred.
+func recoverError(pos token.Pos, err *error) {
+	if r := recover(); r != nil {
+		*err = &Error{Pos: pos, Err: fmt.Errorf("%v", r)}
+	}
+}
+
+// errorValue returns the value caught by catch*, native errors are
+// converted into strings.
+func errorValue(err error) types.Valuer {
+	if e, ok := err.(*Error); ok {
+		err = e.Err
+	}
+	if e, ok := err.(*Exception); ok {
+		return e.Value
+	}
+	return types.String(err.Error())
+}
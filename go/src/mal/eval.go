@@ -3,6 +3,7 @@ package mal
 import (
 	"errors"
 	"fmt"
+	"io"
 
 	"mal/ast"
 	"mal/types"
@@ -12,21 +13,39 @@ var (
 	errIgnore = errors.New("ignore")
 )
 
+// maxDepth limits the nesting of evaluation, Go cannot recover from the
+// stack overflow so the deep recursion is reported as an error instead.
+const maxDepth = 200000
+
 type Evaler struct {
-	env *Env
+	env      *Env
+	depth    *int // Shared with the evalers of the nested environments
+	features []string
 }
 
 func NewEvaler(env *Env) *Evaler {
+	e := &Evaler{env: env, depth: new(int)}
 	for k, v := range funcmap {
-		env.Set(k, types.NewFunc(k, v))
+		env.Set(k, types.NewFunc(k, v.spec.wrap(k, v.fn)))
+	}
+	for k, v := range constmap {
+		env.Set(k, v)
+	}
+	for k, v := range evalfuncmap {
+		fn := v.fn
+		env.Set(k, types.NewFunc(k, v.spec.wrap(k, func(vs ...types.Valuer) (types.Valuer, error) {
+			return fn(e, vs...)
+		})))
 	}
-	return &Evaler{env: env}
+	return e
 }
 
+// EvalAST evaluates all top level forms, panics raised during evaluation are
+// converted into *Error at the position of the form.
 func (e *Evaler) EvalAST(a *ast.AST) (vs []types.Valuer, err error) {
 	a.Walk(func(node ast.Node) bool {
 		var v types.Valuer
-		v, err = e.evalNode(node)
+		v, err = e.evalSafely(node)
 		if err == errIgnore {
 			err = nil
 			return true
@@ -40,14 +59,87 @@ func (e *Evaler) EvalAST(a *ast.AST) (vs []types.Valuer, err error) {
 	return
 }
 
+// EvalDecoder evaluates the forms one by one as they are decoded, it returns
+// the value of the last form.
+func (e *Evaler) EvalDecoder(d *ast.Decoder) (types.Valuer, error) {
+	var v types.Valuer = types.Nil{}
+	for {
+		node, err := d.Decode()
+		if err == io.EOF {
+			return v, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		x, err := e.evalSafely(node)
+		if err == errIgnore {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		v = x
+	}
+}
+
+// EvalEach evaluates the forms one by one as they are decoded and passes
+// the results to fn, the errors of the evaluation are passed to fn as well
+// and don't stop it. It returns the error of the reader if any.
+func (e *Evaler) EvalEach(d *ast.Decoder, fn func(types.Valuer, error)) error {
+	for {
+		node, err := d.Decode()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		v, err := e.evalSafely(node)
+		if err == errIgnore {
+			continue
+		}
+		fn(v, err)
+	}
+}
+
+// withEnv returns the evaler of the nested environment env.
+func (e *Evaler) withEnv(env *Env) *Evaler {
+	return &Evaler{env: env, depth: e.depth, features: e.features}
+}
+
+// SetFeatures sets the features selected by the reader conditionals in the
+// code read by read-string and load-file, see ast.AST.Features.
+func (e *Evaler) SetFeatures(features ...string) {
+	e.features = features
+}
+
+func (e *Evaler) evalSafely(node ast.Node) (v types.Valuer, err error) {
+	defer recoverError(node.Pos(), &err)
+	return e.evalNode(node)
+}
+
 func (e *Evaler) evalNode(node ast.Node) (types.Valuer, error) {
+	if *e.depth >= maxDepth {
+		return nil, errorf(node.Pos(), "maximum evaluation depth %d exceeded", maxDepth)
+	}
+	*e.depth++
+	defer func() { *e.depth-- }()
+
 	switch x := node.(type) {
-	case *ast.Comment:
+	case *ast.Comment, *ast.Discard:
 		return nil, errIgnore
+	case *ast.AnonFn:
+		fn, err := expandAnonFn(x)
+		if err != nil {
+			return nil, err
+		}
+		return e.evalNode(fn)
+	case *valueNode:
+		return x.value, nil
 	case *ast.Symbol:
 		return e.evalSymbol(x)
 	case *ast.AtomSingle:
-		return e.evalAtomSingle(x), nil
+		return evalAtomSingle(x)
 	case *ast.AtomContainer:
 		return e.evalAtomContainer(x)
 	case *ast.List:
@@ -60,7 +152,7 @@ func (e *Evaler) evalNode(node ast.Node) (types.Valuer, error) {
 func (e *Evaler) evalSymbol(symbol *ast.Symbol) (types.Valuer, error) {
 	env, err := e.env.Get(symbol.Content)
 	if err != nil {
-		return nil, fmt.Errorf("[%s] %v", symbol.Pos(), err)
+		return nil, withPos(symbol.Pos(), err)
 	}
 	return env, nil
 }
@@ -75,18 +167,33 @@ func (e *Evaler) evalList(list *ast.List) (types.Valuer, error) {
 		if !ok {
 			return evaler.evalNode(n)
 		}
+		if l.Symbol.Content != "" { // Expanded by reader macro, e.g. @a -> (deref a)
+			l = ast.NewList(l.Pos(), l.End(), listElems(l)...)
+		}
 		if len(l.Elems) == 0 {
-			return types.NewRaw(l), nil
+			return types.NewList(), nil
+		}
+
+		expanded, err := evaler.macroexpand(l)
+		if err != nil {
+			return nil, err
+		}
+		if expanded != ast.Node(l) {
+			n = expanded
+			continue
 		}
 
 		symbol, ok := l.Elems[0].(*ast.Symbol)
-		if !ok { // In place lambda call
-			v, err := e.evalNode(l.Elems[0])
+		if !ok { // In place function call
+			v, err := evaler.evalNode(l.Elems[0])
 			if err != nil {
-				return types.NewRaw(l), nil
+				return nil, err
 			}
-			if fn, ok := v.(types.LambdaFunc); ok {
-				evaler, n, err = evaler.evalLambaFunc(fn, l.Elems[1:])
+			switch fn := v.(type) {
+			case types.Func:
+				return evaler.evalFunc(fn, l)
+			case types.LambdaFunc:
+				evaler, n, err = evaler.evalLambaFunc(fn, l)
 				if err != nil {
 					return nil, err
 				}
@@ -97,34 +204,81 @@ func (e *Evaler) evalList(list *ast.List) (types.Valuer, error) {
 
 		switch symbol.Content {
 		case "def!":
+			if err := checkForm(l, 2, 2); err != nil {
+				return nil, err
+			}
+			name, err := symbolContent(l.Elems[1])
+			if err != nil {
+				return nil, err
+			}
 			v, err := evaler.evalNode(l.Elems[2])
 			if err != nil {
 				return nil, err
 			}
-			evaler.env.Set(l.Elems[1].(*ast.Symbol).Content, v)
+			evaler.env.Set(name, v)
 			return v, nil
 
+		case "defmacro!":
+			if err := checkForm(l, 2, 2); err != nil {
+				return nil, err
+			}
+			name, err := symbolContent(l.Elems[1])
+			if err != nil {
+				return nil, err
+			}
+			v, err := evaler.evalNode(l.Elems[2])
+			if err != nil {
+				return nil, err
+			}
+			fn, ok := v.(types.LambdaFunc)
+			if !ok {
+				return nil, errorf(l.Elems[2].Pos(), "expect function, got %s", v.SPrint(true))
+			}
+			fn.IsMacro = true
+			evaler.env.Set(name, fn)
+			return fn, nil
+
+		case "macroexpand":
+			if err := checkForm(l, 1, 1); err != nil {
+				return nil, err
+			}
+			expanded, err := evaler.macroexpand(l.Elems[1])
+			if err != nil {
+				return nil, err
+			}
+			return nodeToValue(expanded)
+
 		case "let*":
-			var elems []ast.Node
-			switch x := l.Elems[1].(type) {
-			case *ast.List:
-				elems = x.Elems
-			case *ast.AtomContainer:
-				if x.Kind != ast.Vector {
-					return nil, fmt.Errorf("[%s] expect list or vector, got map", x.Pos())
-				}
-				elems = x.Elems
+			if err := checkForm(l, 2, 2); err != nil {
+				return nil, err
+			}
+			elems, err := bindingElems(l.Elems[1])
+			if err != nil {
+				return nil, err
+			}
+			if len(elems)%2 != 0 {
+				return nil, errorf(l.Elems[1].Pos(), "let*: symbol/value pair required")
 			}
 			letenv := NewEnv(evaler.env, nil, nil)
 			for i := 0; i < len(elems); i = i + 2 {
-				v, _ := NewEvaler(letenv).evalNode(elems[i+1])
-				letenv.Set(elems[i].(*ast.Symbol).Content, v)
+				name, err := symbolContent(elems[i])
+				if err != nil {
+					return nil, err
+				}
+				v, err := evaler.withEnv(letenv).evalNode(elems[i+1])
+				if err != nil {
+					return nil, err
+				}
+				letenv.Set(name, v)
 			}
 
-			evaler = NewEvaler(letenv)
+			evaler = evaler.withEnv(letenv)
 			n = l.Elems[2]
 
 		case "do":
+			if len(l.Elems) == 1 {
+				return types.Nil{}, nil
+			}
 			last := len(l.Elems) - 1
 			for _, elem := range l.Elems[1:last] {
 				if _, err := evaler.evalNode(elem); err != nil {
@@ -137,6 +291,9 @@ func (e *Evaler) evalList(list *ast.List) (types.Valuer, error) {
 			n = l.Elems[last]
 
 		case "if":
+			if err := checkForm(l, 2, 3); err != nil {
+				return nil, err
+			}
 			v1, err := evaler.evalNode(l.Elems[1])
 			if err != nil && err != errIgnore {
 				return nil, err
@@ -159,20 +316,60 @@ func (e *Evaler) evalList(list *ast.List) (types.Valuer, error) {
 				n = l.Elems[2]
 			}
 
+		case "quote":
+			if err := checkForm(l, 1, 1); err != nil {
+				return nil, err
+			}
+			return nodeToValue(l.Elems[1])
+
+		case "quasiquote":
+			if err := checkForm(l, 1, 1); err != nil {
+				return nil, err
+			}
+			qq, err := quasiquote(l.Elems[1])
+			if err != nil {
+				return nil, err
+			}
+			n = qq
+
+		case "try*":
+			if err := checkForm(l, 1, 2); err != nil {
+				return nil, err
+			}
+			v, err := evaler.evalNode(l.Elems[1])
+			if err == nil || err == errIgnore || len(l.Elems) < 3 {
+				return v, err
+			}
+			catch, ok := l.Elems[2].(*ast.List)
+			if !ok || len(catch.Elems) < 3 || !isSymbol(catch.Elems[0], "catch*") {
+				return nil, errorf(l.Elems[2].Pos(), "expect (catch* symbol expr)")
+			}
+			name, serr := symbolContent(catch.Elems[1])
+			if serr != nil {
+				return nil, serr
+			}
+			catchenv := NewEnv(evaler.env, []string{name}, []types.Valuer{errorValue(err)})
+			evaler = evaler.withEnv(catchenv)
+			n = catch.Elems[2]
+
 		case "fn*":
-			var elems []ast.Node
-			switch x := l.Elems[1].(type) {
-			case *ast.List:
-				elems = x.Elems
-			case *ast.AtomContainer:
-				if x.Kind != ast.Vector {
-					return nil, fmt.Errorf("[%s] expect list or vector, got map", x.Pos())
-				}
-				elems = x.Elems
+			if err := checkForm(l, 2, 2); err != nil {
+				return nil, err
+			}
+			elems, err := bindingElems(l.Elems[1])
+			if err != nil {
+				return nil, err
 			}
 			binds := []string{}
-			for _, elem := range elems {
-				binds = append(binds, elem.(*ast.Symbol).Content)
+			for i, elem := range elems {
+				name, err := symbolContent(elem)
+				if err != nil {
+					return nil, err
+				}
+				if name == "&" && i != len(elems)-2 {
+					return nil, errorf(elem.Pos(), "fn*: expect exactly one symbol after &")
+				}
+				binds = append(binds, name)
 			}
 			return types.NewLambdaFunc(evaler.env, l.Elems[2], binds), nil
 
@@ -183,10 +380,10 @@ func (e *Evaler) evalList(list *ast.List) (types.Valuer, error) {
 			}
 			switch fn := ev.(type) {
 			case types.Func:
-				return evaler.evalFunc(fn, l.Elems[1:])
+				return evaler.evalFunc(fn, l)
 			case types.LambdaFunc:
 				var err error
-				evaler, n, err = evaler.evalLambaFunc(fn, l.Elems[1:])
+				evaler, n, err = evaler.evalLambaFunc(fn, l)
 				if err != nil {
 					return nil, err
 				}
@@ -197,10 +394,10 @@ func (e *Evaler) evalList(list *ast.List) (types.Valuer, error) {
 	}
 }
 
-func (e *Evaler) evalLambaFunc(fn types.LambdaFunc, nodes []ast.Node) (evaler *Evaler, n ast.Node, err error) {
+func (e *Evaler) evalLambaFunc(fn types.LambdaFunc, l *ast.List) (evaler *Evaler, n ast.Node, err error) {
 	exprs := []types.Valuer{}
 	var ev types.Valuer
-	for _, nn := range nodes {
+	for _, nn := range l.Elems[1:] {
 		ev, err = e.evalNode(nn)
 		if err != nil {
 			if err == errIgnore {
@@ -211,15 +408,72 @@ func (e *Evaler) evalLambaFunc(fn types.LambdaFunc, nodes []ast.Node) (evaler *E
 		}
 		exprs = append(exprs, ev)
 	}
+	if err = checkBinds(fn, exprs); err != nil {
+		err = withPos(l.Pos(), err)
+		return
+	}
 
-	evaler = NewEvaler(NewEnv(fn.Env.(*Env), fn.Binds, exprs))
+	evaler = e.withEnv(NewEnv(fn.Env.(*Env), fn.Binds, exprs))
 	n = fn.Expr.(ast.Node)
 	return
 }
 
-func (e *Evaler) evalFunc(fn types.Func, nodes []ast.Node) (types.Valuer, error) {
-	args := make([]types.Valuer, len(nodes))
-	for i, node := range nodes {
+// macroexpand expands the node until it is not a macro call.
+func (e *Evaler) macroexpand(node ast.Node) (ast.Node, error) {
+	for {
+		l, ok := node.(*ast.List)
+		if !ok {
+			return node, nil
+		}
+		elems := listElems(l)
+		if len(elems) == 0 {
+			return node, nil
+		}
+		symbol, ok := elems[0].(*ast.Symbol)
+		if !ok {
+			return node, nil
+		}
+		v, ok := e.env.Find(symbol.Content)
+		if !ok {
+			return node, nil
+		}
+		fn, ok := v.(types.LambdaFunc)
+		if !ok || !fn.IsMacro {
+			return node, nil
+		}
+
+		args, err := nodesToValues(elems[1:])
+		if err != nil {
+			return nil, err
+		}
+		expanded, err := e.applyFunc(fn, args...)
+		if err != nil {
+			return nil, err
+		}
+		node = valueToNode(expanded, node.Pos())
+	}
+}
+
+// applyFunc calls the types.Func or types.LambdaFunc with evaluated arguments.
+func (e *Evaler) applyFunc(fn types.Valuer, args ...types.Valuer) (types.Valuer, error) {
+	switch f := fn.(type) {
+	case types.Func:
+		return f.Exec(args...)
+	case types.LambdaFunc:
+		if err := checkBinds(f, args); err != nil {
+			return nil, err
+		}
+		evaler := e.withEnv(NewEnv(f.Env.(*Env), f.Binds, args))
+		return evaler.evalNode(f.Expr.(ast.Node))
+	}
+	return nil, fmt.Errorf("%s is not a function", fn.SPrint(true))
+}
+
+// evalFunc calls the native function with the arguments of l, errors and
+// panics raised by fn are reported at the position of l.
+func (e *Evaler) evalFunc(fn types.Func, l *ast.List) (v types.Valuer, err error) {
+	args := make([]types.Valuer, 0, len(l.Elems)-1)
+	for _, node := range l.Elems[1:] {
 		v, err := e.evalNode(node)
 		if err != nil {
 			if err == errIgnore {
@@ -227,33 +481,96 @@ func (e *Evaler) evalFunc(fn types.Func, nodes []ast.Node) (types.Valuer, error)
 			}
 			return nil, err
 		}
-		args[i] = v
+		args = append(args, v)
+	}
+
+	defer recoverError(l.Pos(), &err)
+	v, err = fn.Exec(args...)
+	return v, withPos(l.Pos(), err)
+}
+
+// checkForm checks the number of arguments of special form l, max < 0 means
+// there is no upper limit.
+func checkForm(l *ast.List, min, max int) error {
+	n := len(l.Elems) - 1
+	if n >= min && (max < 0 || n <= max) {
+		return nil
+	}
+	name := l.Elems[0].String()
+	switch {
+	case min == max:
+		return errorf(l.Pos(), "%s: expected %s, got %d", name, arguments(min), n)
+	case n < min:
+		return errorf(l.Pos(), "%s: expected at least %s, got %d", name, arguments(min), n)
+	}
+	return errorf(l.Pos(), "%s: expected at most %s, got %d", name, arguments(max), n)
+}
+
+func symbolContent(node ast.Node) (string, error) {
+	symbol, ok := node.(*ast.Symbol)
+	if !ok {
+		return "", errorf(node.Pos(), "expect symbol, got %s", node)
+	}
+	return symbol.Content, nil
+}
+
+// bindingElems returns the elements of the bindings of let* and fn*.
+func bindingElems(node ast.Node) ([]ast.Node, error) {
+	switch x := node.(type) {
+	case *ast.List:
+		return listElems(x), nil
+	case *ast.AtomContainer:
+		if x.Kind == ast.Vector {
+			return x.Elems, nil
+		}
 	}
-	return fn.Exec(args...)
+	return nil, errorf(node.Pos(), "expect list or vector, got %s", node)
 }
 
-func (e *Evaler) evalAtomSingle(as *ast.AtomSingle) types.Valuer {
+func evalAtomSingle(as *ast.AtomSingle) (types.Valuer, error) {
 	switch as.Kind {
 	case ast.Nil:
-		return types.Nil{}
+		return types.Nil{}, nil
 	case ast.Bool:
-		return types.NewBool(as.Content)
+		return types.NewBool(as.Content), nil
 	case ast.Int:
-		return types.NewInt(as.Content)
+		return types.NewInt(as.Content), nil
 	case ast.Float:
-		return types.NewFloat(as.Content)
+		return types.NewFloat(as.Content), nil
+	case ast.Ratio:
+		r, err := types.NewRatio(as.Content)
+		if err != nil {
+			return nil, withPos(as.Pos(), err)
+		}
+		return r, nil
 	case ast.String:
-		return types.String(as.Content[1 : len(as.Content)-1])
+		s, err := ast.Unquote(as.Content)
+		if err != nil {
+			return nil, withPos(as.Pos(), err)
+		}
+		return types.String(s), nil
 	case ast.Keyword:
-		return types.Keyword(as.Content[1:])
+		return types.Keyword(as.Content[1:]), nil
+	case ast.Char:
+		c, err := types.NewChar(as.Content)
+		if err != nil {
+			return nil, withPos(as.Pos(), err)
+		}
+		return c, nil
+	case ast.Regex:
+		re, err := types.NewRegex(as.Content[2 : len(as.Content)-1])
+		if err != nil {
+			return nil, withPos(as.Pos(), err)
+		}
+		return re, nil
 	}
-	panic("how dare you")
+	return nil, errorf(as.Pos(), "unknown atom: %s", as)
 }
 
 func (e *Evaler) evalAtomContainer(ac *ast.AtomContainer) (types.Valuer, error) {
 	switch ac.Kind {
 	case ast.Vector:
-		vec := &types.Vector{}
+		vec := types.NewVector()
 		for _, elem := range ac.Elems {
 			v, err := e.evalNode(elem)
 			if err != nil {
@@ -262,12 +579,12 @@ func (e *Evaler) evalAtomContainer(ac *ast.AtomContainer) (types.Valuer, error)
 				}
 				return nil, err
 			}
-			vec.Append(v)
+			vec = vec.Conj(v)
 		}
 		return vec, nil
 	case ast.Map:
-		m := types.Map{}
-		var k types.Valuer
+		m := types.NewMap()
+		var k types.MapKey
 		for _, elem := range ac.Elems {
 			v, err := e.evalNode(elem)
 			if err != nil {
@@ -277,16 +594,36 @@ func (e *Evaler) evalAtomContainer(ac *ast.AtomContainer) (types.Valuer, error)
 				return nil, err
 			}
 			if k == nil {
-				k = v.(types.MapKey)
+				var ok bool
+				if k, ok = v.(types.MapKey); !ok {
+					return nil, errorf(elem.Pos(), "invalid map key: %s", v.SPrint(true))
+				}
 			} else {
-				m[k] = v
+				m.Set(k, v)
 				k = nil
 			}
 		}
 		if k != nil {
-			return nil, fmt.Errorf("[%s] key/value pair required", ac.End())
+			return nil, errorf(ac.End(), "key/value pair required")
 		}
 		return m, nil
+	case ast.Set:
+		set := types.NewSet()
+		for _, elem := range ac.Elems {
+			v, err := e.evalNode(elem)
+			if err != nil {
+				if err == errIgnore {
+					continue
+				}
+				return nil, err
+			}
+			k, ok := v.(types.MapKey)
+			if !ok {
+				return nil, errorf(elem.Pos(), "invalid set element: %s", v.SPrint(true))
+			}
+			set = set.Conj(k)
+		}
+		return set, nil
 	}
-	panic("how dare you")
+	return nil, errorf(ac.Pos(), "unknown container: %s", ac)
 }
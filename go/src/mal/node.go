@@ -0,0 +1,259 @@
+package mal
+
+import (
+	"strconv"
+	"strings"
+
+	"mal/ast"
+	"mal/ast/token"
+	"mal/types"
+)
+
+// valueNode wraps an already evaluated value so that it can be put back
+// into the AST, e.g. the result of read-string passed to eval.
+type valueNode struct {
+	pos   token.Pos
+	value types.Valuer
+}
+
+func (n *valueNode) Pos() token.Pos {
+	return n.pos
+}
+
+func (n *valueNode) End() token.Pos {
+	return n.pos
+}
+
+func (n *valueNode) String() string {
+	return n.value.SPrint(true)
+}
+
+// nodeToValue converts the node into value without evaluating it.
+func nodeToValue(node ast.Node) (types.Valuer, error) {
+	switch x := node.(type) {
+	case *ast.Comment, *ast.Discard:
+		return nil, errIgnore
+	case *ast.AnonFn:
+		fn, err := expandAnonFn(x)
+		if err != nil {
+			return nil, err
+		}
+		return nodeToValue(fn)
+	case *valueNode:
+		return x.value, nil
+	case *ast.Symbol:
+		return types.Symbol(x.Content), nil
+	case *ast.AtomSingle:
+		return evalAtomSingle(x)
+	case *ast.AtomContainer:
+		vs, err := nodesToValues(x.Elems)
+		if err != nil {
+			return nil, err
+		}
+		switch x.Kind {
+		case ast.Vector:
+			return types.NewVector(vs...), nil
+		case ast.Set:
+			set := types.NewSet()
+			for i, v := range vs {
+				k, ok := v.(types.MapKey)
+				if !ok {
+					return nil, errorf(x.Elems[i].Pos(), "invalid set element: %s", v.SPrint(true))
+				}
+				set = set.Conj(k)
+			}
+			return set, nil
+		}
+		m := types.NewMap()
+		if len(vs)%2 != 0 {
+			return nil, errorf(x.End(), "key/value pair required")
+		}
+		for i := 0; i < len(vs); i += 2 {
+			k, ok := vs[i].(types.MapKey)
+			if !ok {
+				return nil, errorf(x.Elems[i].Pos(), "invalid map key: %s", vs[i].SPrint(true))
+			}
+			m.Set(k, vs[i+1])
+		}
+		return m, nil
+	case *ast.List:
+		vs, err := nodesToValues(listElems(x))
+		if err != nil {
+			return nil, err
+		}
+		return types.NewList(vs...), nil
+	}
+	return types.NewRaw(node), nil
+}
+
+func nodesToValues(nodes []ast.Node) ([]types.Valuer, error) {
+	vs := []types.Valuer{}
+	for _, node := range nodes {
+		v, err := nodeToValue(node)
+		if err != nil {
+			if err == errIgnore {
+				continue
+			}
+			return nil, err
+		}
+		vs = append(vs, v)
+	}
+	return vs, nil
+}
+
+// listElems returns all elements of the list, the symbol of reader macro
+// is included, e.g. 'a -> (quote a).
+func listElems(l *ast.List) []ast.Node {
+	if l.Symbol.Content == "" {
+		return l.Elems
+	}
+	return append([]ast.Node{l.Symbol}, l.Elems...)
+}
+
+func isSymbol(node ast.Node, content string) bool {
+	symbol, ok := node.(*ast.Symbol)
+	return ok && symbol.Content == content
+}
+
+// quasiquote rewrites the node into the calls of cons and concat, e.g.
+// `(1 ~a ~@b) -> (cons (quote 1) (cons a (concat b (quote ()))))
+func quasiquote(node ast.Node) (ast.Node, error) {
+	var elems []ast.Node
+	switch x := node.(type) {
+	case *ast.List:
+		elems = listElems(x)
+	case *ast.AtomContainer:
+		if x.Kind == ast.Vector {
+			elems = x.Elems
+		}
+	}
+	pos, end := node.Pos(), node.End()
+	if len(elems) == 0 {
+		return ast.NewList(pos, end, ast.NewSymbol(pos, "quote"), node), nil
+	}
+	if isSymbol(elems[0], "unquote") {
+		return unquoteOperand(pos, elems)
+	}
+
+	rest, err := quasiquote(ast.NewList(elems[0].End(), end, elems[1:]...))
+	if err != nil {
+		return nil, err
+	}
+	if l, ok := elems[0].(*ast.List); ok {
+		if lelems := listElems(l); len(lelems) > 0 && isSymbol(lelems[0], "splice-unquote") {
+			operand, err := unquoteOperand(l.Pos(), lelems)
+			if err != nil {
+				return nil, err
+			}
+			return ast.NewList(pos, end, ast.NewSymbol(pos, "concat"), operand, rest), nil
+		}
+	}
+	first, err := quasiquote(elems[0])
+	if err != nil {
+		return nil, err
+	}
+	return ast.NewList(pos, end, ast.NewSymbol(pos, "cons"), first, rest), nil
+}
+
+// unquoteOperand returns the operand of unquote or splice-unquote, elems
+// starts with the symbol.
+func unquoteOperand(pos token.Pos, elems []ast.Node) (ast.Node, error) {
+	if n := len(elems) - 1; n != 1 {
+		return nil, errorf(pos, "%s: expected %s, got %d", elems[0], arguments(1), n)
+	}
+	return elems[1], nil
+}
+
+// expandAnonFn rewrites #() into fn*, e.g. #(+ % %2) -> (fn* (%1 %2) (+ %1 %2)),
+// %& is bound to the rest arguments.
+func expandAnonFn(fn *ast.AnonFn) (ast.Node, error) {
+	n, rest := 0, false
+	var rewrite func(nodes []ast.Node) ([]ast.Node, error)
+	rewrite = func(nodes []ast.Node) ([]ast.Node, error) {
+		rewritten := make([]ast.Node, len(nodes))
+		for i, node := range nodes {
+			switch x := node.(type) {
+			case *ast.AnonFn:
+				return nil, errorf(x.Pos(), "nested #() is not allowed")
+			case *ast.Symbol:
+				switch {
+				case x.Content == "%":
+					node = ast.NewSymbol(x.Pos(), "%1")
+					if n < 1 {
+						n = 1
+					}
+				case x.Content == "%&":
+					rest = true
+				case strings.HasPrefix(x.Content, "%"):
+					if k, err := strconv.Atoi(x.Content[1:]); err == nil && k > n {
+						n = k
+					}
+				}
+			case *ast.List:
+				elems, err := rewrite(listElems(x))
+				if err != nil {
+					return nil, err
+				}
+				node = ast.NewList(x.Pos(), x.End(), elems...)
+			case *ast.AtomContainer:
+				elems, err := rewrite(x.Elems)
+				if err != nil {
+					return nil, err
+				}
+				node = ast.NewAtomContainer(x.Kind, x.Pos(), x.End(), elems...)
+			}
+			rewritten[i] = node
+		}
+		return rewritten, nil
+	}
+
+	body, err := rewrite(fn.Elems)
+	if err != nil {
+		return nil, err
+	}
+	pos, end := fn.Pos(), fn.End()
+	params := []ast.Node{}
+	for i := 1; i <= n; i++ {
+		params = append(params, ast.NewSymbol(pos, "%"+strconv.Itoa(i)))
+	}
+	if rest {
+		params = append(params, ast.NewSymbol(pos, "&"), ast.NewSymbol(pos, "%&"))
+	}
+	return ast.NewList(pos, end, ast.NewSymbol(pos, "fn*"),
+		ast.NewList(pos, end, params...), ast.NewList(pos, end, body...)), nil
+}
+
+// valueToNode converts the value back into node, pos is used as the position
+// of all generated nodes since values do not remember where they came from.
+func valueToNode(v types.Valuer, pos token.Pos) ast.Node {
+	switch x := v.(type) {
+	case types.Symbol:
+		return ast.NewSymbol(pos, string(x))
+	case types.List:
+		elems := []ast.Node{}
+		for _, elem := range x.Elems() {
+			elems = append(elems, valueToNode(elem, pos))
+		}
+		return ast.NewList(pos, pos, elems...)
+	case *types.Vector:
+		elems := []ast.Node{}
+		for _, elem := range x.Elems() {
+			elems = append(elems, valueToNode(elem, pos))
+		}
+		return ast.NewAtomContainer(ast.Vector, pos, pos, elems...)
+	case types.Map:
+		elems := []ast.Node{}
+		for _, k := range x.Keys() {
+			elem, _ := x.Get(k)
+			elems = append(elems, valueToNode(k, pos), valueToNode(elem, pos))
+		}
+		return ast.NewAtomContainer(ast.Map, pos, pos, elems...)
+	case types.Set:
+		elems := []ast.Node{}
+		for _, elem := range x.Elems() {
+			elems = append(elems, valueToNode(elem, pos))
+		}
+		return ast.NewAtomContainer(ast.Set, pos, pos, elems...)
+	}
+	return &valueNode{pos: pos, value: v}
+}
@@ -0,0 +1,37 @@
+package mal
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"mal/ast"
+)
+
+var stdin = bufio.NewReader(os.Stdin)
+
+// Readline prints the prompt and reads a line from the stdin, the line
+// ending is not included. It shares the buffer with the readline function.
+func Readline(prompt string) (string, error) {
+	fmt.Print(prompt)
+	line, err := stdin.ReadString('\n')
+	if err != nil && !(err == io.EOF && line != "") {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// IsTerminal reports whether the stdin is a terminal, the input is piped
+// otherwise.
+func IsTerminal() bool {
+	fi, err := os.Stdin.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// NewStdinDecoder returns a decoder of the forms piped to the stdin, it
+// shares the buffer with Readline.
+func NewStdinDecoder(features ...string) *ast.Decoder {
+	return ast.NewDecoder(stdin, features...)
+}
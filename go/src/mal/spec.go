@@ -0,0 +1,213 @@
+package mal
+
+import (
+	"fmt"
+
+	"mal/types"
+)
+
+// argSpec describes the type of an argument.
+type argSpec struct {
+	name  string
+	check func(types.Valuer) bool
+}
+
+var (
+	anyArg = argSpec{"any", func(types.Valuer) bool { return true }}
+
+	numberArg = argSpec{"number", func(v types.Valuer) bool {
+		_, ok := v.(types.Number)
+		return ok
+	}}
+	intArg = argSpec{"int", func(v types.Valuer) bool {
+		_, ok := v.(types.Int)
+		return ok
+	}}
+	stringArg = argSpec{"string", func(v types.Valuer) bool {
+		_, ok := v.(types.String)
+		return ok
+	}}
+	charArg = argSpec{"char", func(v types.Valuer) bool {
+		_, ok := v.(types.Char)
+		return ok
+	}}
+	charOrNumberArg = argSpec{"char or number", func(v types.Valuer) bool {
+		switch v.(type) {
+		case types.Char, types.Number:
+			return true
+		}
+		return false
+	}}
+	regexArg = argSpec{"regex", func(v types.Valuer) bool {
+		_, ok := v.(types.Regex)
+		return ok
+	}}
+	stringOrKeywordArg = argSpec{"string or keyword", func(v types.Valuer) bool {
+		switch v.(type) {
+		case types.String, types.Keyword:
+			return true
+		}
+		return false
+	}}
+	atomArg = argSpec{"atom", func(v types.Valuer) bool {
+		_, ok := v.(*types.Atom)
+		return ok
+	}}
+	fnArg = argSpec{"function", func(v types.Valuer) bool {
+		switch v.(type) {
+		case types.Func, types.LambdaFunc:
+			return true
+		}
+		return false
+	}}
+	collArg = argSpec{"list, vector or set", func(v types.Valuer) bool {
+		switch v.(type) {
+		case types.List, *types.Vector, types.Set:
+			return true
+		}
+		return false
+	}}
+	seqArg = argSpec{"list, vector or nil", func(v types.Valuer) bool {
+		switch v.(type) {
+		case types.List, *types.Vector, types.Nil:
+			return true
+		}
+		return false
+	}}
+	seqableArg = argSpec{"list, vector, string or nil", func(v types.Valuer) bool {
+		switch v.(type) {
+		case types.List, *types.Vector, types.String, types.Nil:
+			return true
+		}
+		return false
+	}}
+	seqOrSetArg = argSpec{"list, vector, set or nil", func(v types.Valuer) bool {
+		switch v.(type) {
+		case types.List, *types.Vector, types.Set, types.Nil:
+			return true
+		}
+		return false
+	}}
+	setArg = argSpec{"set", func(v types.Valuer) bool {
+		_, ok := v.(types.Set)
+		return ok
+	}}
+	mapArg = argSpec{"map", func(v types.Valuer) bool {
+		_, ok := v.(types.Map)
+		return ok
+	}}
+	mapOrNilArg = argSpec{"map or nil", func(v types.Valuer) bool {
+		switch v.(type) {
+		case types.Map, types.Nil:
+			return true
+		}
+		return false
+	}}
+	mapSetOrNilArg = argSpec{"map, set or nil", func(v types.Valuer) bool {
+		switch v.(type) {
+		case types.Map, types.Set, types.Nil:
+			return true
+		}
+		return false
+	}}
+)
+
+// funcSpec describes the arguments of a core function, rest is used to check
+// the arguments after args if it is variadic.
+type funcSpec struct {
+	args []argSpec
+	rest *argSpec
+}
+
+// arity accepts exactly len(args) arguments.
+func arity(args ...argSpec) funcSpec {
+	return funcSpec{args: args}
+}
+
+// variadic accepts args followed by any number of rest arguments.
+func variadic(rest argSpec, args ...argSpec) funcSpec {
+	return funcSpec{args: args, rest: &rest}
+}
+
+func (s funcSpec) check(name string, vs []types.Valuer) error {
+	n := len(s.args)
+	if s.rest == nil && len(vs) != n {
+		return fmt.Errorf("%s: expected %s, got %d", name, arguments(n), len(vs))
+	}
+	if s.rest != nil && len(vs) < n {
+		return fmt.Errorf("%s: expected at least %s, got %d", name, arguments(n), len(vs))
+	}
+	for i, v := range vs {
+		spec := s.rest
+		if i < n {
+			spec = &s.args[i]
+		}
+		if !spec.check(v) {
+			return fmt.Errorf("%s: expected %s as argument %d, got %s", name, spec.name, i+1, typeName(v))
+		}
+	}
+	return nil
+}
+
+func arguments(n int) string {
+	if n == 1 {
+		return "1 argument"
+	}
+	return fmt.Sprintf("%d arguments", n)
+}
+
+// wrap returns a function which checks the arguments before calling fn.
+func (s funcSpec) wrap(name string, fn types.FuncType) types.FuncType {
+	return func(vs ...types.Valuer) (types.Valuer, error) {
+		if err := s.check(name, vs); err != nil {
+			return nil, err
+		}
+		return fn(vs...)
+	}
+}
+
+// typeName returns the name of the type of v used in the error messages.
+func typeName(v types.Valuer) string {
+	switch x := v.(type) {
+	case types.Raw:
+		return "form"
+	case types.Nil:
+		return "nil"
+	case types.Bool:
+		return "bool"
+	case types.Int, types.BigInt:
+		return "int"
+	case types.Float:
+		return "float"
+	case types.Ratio:
+		return "ratio"
+	case types.String:
+		return "string"
+	case types.Char:
+		return "char"
+	case types.Regex:
+		return "regex"
+	case types.Keyword:
+		return "keyword"
+	case types.Symbol:
+		return "symbol"
+	case types.List:
+		return "list"
+	case *types.Vector:
+		return "vector"
+	case types.Map:
+		return "map"
+	case types.Set:
+		return "set"
+	case *types.Atom:
+		return "atom"
+	case types.Func:
+		return "function"
+	case types.LambdaFunc:
+		if x.IsMacro {
+			return "macro"
+		}
+		return "function"
+	}
+	return "unknown"
+}
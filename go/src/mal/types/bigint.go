@@ -0,0 +1,137 @@
+package types
+
+import (
+	"math"
+	"math/big"
+)
+
+// NewBigInt returns x as Int if it fits into int64, otherwise BigInt.
+func NewBigInt(x *big.Int) Number {
+	if x.IsInt64() {
+		return Int(x.Int64())
+	}
+	return BigInt{x: x}
+}
+
+func (b BigInt) Add(oth Number) (Number, error) {
+	if f, ok := oth.(Float); ok {
+		return b.float().Add(f)
+	}
+	if r, ok := oth.(Ratio); ok {
+		return b.ratio().Add(r)
+	}
+	y, err := toBigInt(oth)
+	if err != nil {
+		return nil, err
+	}
+	return NewBigInt(new(big.Int).Add(b.x, y)), nil
+}
+
+func (b BigInt) Sub(oth Number) (Number, error) {
+	if f, ok := oth.(Float); ok {
+		return b.float().Sub(f)
+	}
+	if r, ok := oth.(Ratio); ok {
+		return b.ratio().Sub(r)
+	}
+	y, err := toBigInt(oth)
+	if err != nil {
+		return nil, err
+	}
+	return NewBigInt(new(big.Int).Sub(b.x, y)), nil
+}
+
+func (b BigInt) Mul(oth Number) (Number, error) {
+	if f, ok := oth.(Float); ok {
+		return b.float().Mul(f)
+	}
+	if r, ok := oth.(Ratio); ok {
+		return b.ratio().Mul(r)
+	}
+	y, err := toBigInt(oth)
+	if err != nil {
+		return nil, err
+	}
+	return NewBigInt(new(big.Int).Mul(b.x, y)), nil
+}
+
+func (b BigInt) Div(oth Number) (Number, error) {
+	if f, ok := oth.(Float); ok {
+		return b.float().Div(f)
+	}
+	if r, ok := oth.(Ratio); ok {
+		return b.ratio().Div(r)
+	}
+	y, err := toBigInt(oth)
+	if err != nil {
+		return nil, err
+	}
+	if y.Sign() == 0 {
+		return nil, ErrDivideByZero
+	}
+	q, m := new(big.Int).QuoRem(b.x, y, new(big.Int))
+	if m.Sign() != 0 {
+		return b.ratio().Div(oth)
+	}
+	return NewBigInt(q), nil
+}
+
+func (b BigInt) Compare(oth Number) (int, error) {
+	if f, ok := oth.(Float); ok {
+		return -compareFloat(f, b.ratio().x), nil
+	}
+	if r, ok := oth.(Ratio); ok {
+		return b.ratio().Compare(r)
+	}
+	y, err := toBigInt(oth)
+	if err != nil {
+		return 0, err
+	}
+	return b.x.Cmp(y), nil
+}
+
+func (b BigInt) IsEqaulTo(oth Valuer) bool {
+	o, ok := oth.(BigInt)
+	return ok && b.x.Cmp(o.x) == 0
+}
+
+func (b BigInt) SPrint(readable bool) string {
+	return b.x.String()
+}
+
+func (b BigInt) Hash() uint64 {
+	return hashString('i', b.x.String())
+}
+
+func (b BigInt) ratio() Ratio {
+	return Ratio{x: new(big.Rat).SetInt(b.x)}
+}
+
+func (b BigInt) float() Float {
+	f, _ := new(big.Float).SetInt(b.x).Float64()
+	return Float(f)
+}
+
+func toBigInt(n Number) (*big.Int, error) {
+	switch x := n.(type) {
+	case Int:
+		return big.NewInt(int64(x)), nil
+	case BigInt:
+		return x.x, nil
+	}
+	return nil, unknownNumber(n)
+}
+
+// compareFloat compares f with x exactly, NaN is unordered and reported as
+// equal, callers which order numbers must check it first.
+func compareFloat(f Float, x *big.Rat) int {
+	switch {
+	case math.IsNaN(float64(f)):
+		return 0
+	case math.IsInf(float64(f), 1):
+		return 1
+	case math.IsInf(float64(f), -1):
+		return -1
+	}
+	return new(big.Rat).SetFloat64(float64(f)).Cmp(x)
+}
@@ -0,0 +1,60 @@
+package types
+
+import (
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+)
+
+var charNames = map[string]Char{
+	"newline":   '\n',
+	"space":     ' ',
+	"tab":       '\t',
+	"return":    '\r',
+	"backspace": '\b',
+	"formfeed":  '\f',
+}
+
+// NewChar parses the character literal like \a, \newline or \u00e9.
+func NewChar(v string) (Char, error) {
+	name := v[1:]
+	if utf8.RuneCountInString(name) == 1 {
+		r, _ := utf8.DecodeRuneInString(name)
+		if r != utf8.RuneError {
+			return Char(r), nil
+		}
+	}
+	if c, ok := charNames[name]; ok {
+		return c, nil
+	}
+	if len(name) == 5 && name[0] == 'u' {
+		if x, err := strconv.ParseUint(name[1:], 16, 16); err == nil {
+			return Char(x), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid character: %s", v)
+}
+
+func (c Char) IsEqaulTo(oth Valuer) bool {
+	o, ok := oth.(Char)
+	return ok && c == o
+}
+
+func (c Char) SPrint(readable bool) string {
+	if !readable {
+		return string(c)
+	}
+	for name, x := range charNames {
+		if x == c {
+			return `\` + name
+		}
+	}
+	if !isPrint(rune(c)) {
+		return fmt.Sprintf(`\u%04x`, rune(c))
+	}
+	return `\` + string(c)
+}
+
+func (c Char) Hash() uint64 {
+	return hashString('c', string(c))
+}
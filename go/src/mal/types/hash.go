@@ -0,0 +1,30 @@
+package types
+
+import "hash/fnv"
+
+// hashString hashes s prefixed by tag, the tag keeps values of different
+// types which print the same, e.g. "a" and :a, apart.
+func hashString(tag byte, s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte{tag})
+	h.Write([]byte(s))
+	return h.Sum64()
+}
+
+// seqHash hashes the elements in order, lists and vectors with the same
+// elements are equal so they share it.
+type seqHash uint64
+
+func newSeqHash() seqHash {
+	return seqHash(hashString('q', ""))
+}
+
+// add mixes the hash of v into h, values which can not be map keys, e.g.
+// functions, are all hashed to 0.
+func (h seqHash) add(v Valuer) seqHash {
+	var x uint64
+	if k, ok := v.(MapKey); ok {
+		x = k.Hash()
+	}
+	return h*1099511628211 ^ seqHash(x)
+}
@@ -0,0 +1,114 @@
+package types
+
+import "strings"
+
+// cons is a cell of List, count is the length of the list starting here.
+type cons struct {
+	first Valuer
+	rest  *cons
+	count int
+}
+
+func NewList(elems ...Valuer) List {
+	var cell *cons
+	for i := len(elems) - 1; i >= 0; i-- {
+		cell = &cons{first: elems[i], rest: cell, count: len(elems) - i}
+	}
+	return List{cell: cell}
+}
+
+func (l List) Len() int {
+	if l.cell == nil {
+		return 0
+	}
+	return l.cell.count
+}
+
+// Cons returns a new list with v in front of l.
+func (l List) Cons(v Valuer) List {
+	return List{cell: &cons{first: v, rest: l.cell, count: l.Len() + 1}}
+}
+
+// First returns the first element, nil if l is empty.
+func (l List) First() Valuer {
+	if l.cell == nil {
+		return Nil{}
+	}
+	return l.cell.first
+}
+
+// Rest returns the list without the first element, it is empty if l is.
+func (l List) Rest() List {
+	if l.cell == nil {
+		return l
+	}
+	return List{cell: l.cell.rest}
+}
+
+func (l List) Elems() []Valuer {
+	elems := make([]Valuer, 0, l.Len())
+	for c := l.cell; c != nil; c = c.rest {
+		elems = append(elems, c.first)
+	}
+	return elems
+}
+
+func (l List) ToVector() *Vector {
+	return NewVector(l.Elems()...)
+}
+
+func (l List) Meta() Valuer {
+	return metaOrNil(l.meta)
+}
+
+func (l List) WithMeta(meta Valuer) Valuer {
+	l.meta = meta
+	return l
+}
+
+func (l List) IsEqaulTo(oth Valuer) bool {
+	var o List
+	switch x := oth.(type) {
+	case *Vector:
+		return l.ToVector().IsEqaulTo(x)
+	case List:
+		o = x
+	default:
+		return false
+	}
+
+	if l.Len() != o.Len() {
+		return false
+	}
+	for c1, c2 := l.cell, o.cell; c1 != nil; c1, c2 = c1.rest, c2.rest {
+		if c1 == c2 {
+			break
+		}
+		if !c1.first.IsEqaulTo(c2.first) {
+			return false
+		}
+	}
+	return true
+}
+
+func (l List) Hash() uint64 {
+	h := newSeqHash()
+	for c := l.cell; c != nil; c = c.rest {
+		h = h.add(c.first)
+	}
+	return uint64(h)
+}
+
+func (l List) SPrint(readable bool) string {
+	elems := []string{"("}
+	for c := l.cell; c != nil; c = c.rest {
+		s := c.first.SPrint(readable)
+		if c == l.cell {
+			elems = append(elems, s)
+		} else {
+			elems = append(elems, " "+s)
+		}
+	}
+	elems = append(elems, ")")
+	return strings.Join(elems, "")
+}
@@ -0,0 +1,289 @@
+package types
+
+import (
+	"fmt"
+	"math/bits"
+	"sort"
+	"strings"
+)
+
+const (
+	hamtBits = 5
+	hamtMask = 1<<hamtBits - 1
+)
+
+// mapEntry remembers when it was added by seq, so that the entries can be
+// iterated in insertion order.
+type mapEntry struct {
+	key   MapKey
+	value Valuer
+	seq   int
+}
+
+// hamtNode stores a slot for every bit set in bitmap, nodes are never changed
+// once they are reachable from a Map.
+type hamtNode struct {
+	bitmap uint32
+	slots  []hamtSlot
+}
+
+// hamtSlot is either a sub node or a leaf holding the entries whose keys
+// have the same hash.
+type hamtSlot struct {
+	node    *hamtNode
+	hash    uint64
+	entries []mapEntry
+}
+
+var emptyHamtNode = &hamtNode{}
+
+func (n *hamtNode) index(shift uint, h uint64) (bit uint32, pos int) {
+	bit = 1 << ((h >> shift) & hamtMask)
+	return bit, bits.OnesCount32(n.bitmap & (bit - 1))
+}
+
+func (n *hamtNode) get(shift uint, h uint64, k MapKey) (mapEntry, bool) {
+	for {
+		bit, pos := n.index(shift, h)
+		if n.bitmap&bit == 0 {
+			return mapEntry{}, false
+		}
+		slot := n.slots[pos]
+		if slot.node == nil {
+			if slot.hash == h {
+				for _, e := range slot.entries {
+					if e.key.IsEqaulTo(k) {
+						return e, true
+					}
+				}
+			}
+			return mapEntry{}, false
+		}
+		n, shift = slot.node, shift+hamtBits
+	}
+}
+
+// assoc returns a new node with e added, the seq of e is ignored if the key
+// already exists.
+func (n *hamtNode) assoc(shift uint, h uint64, e mapEntry) (*hamtNode, bool) {
+	bit, pos := n.index(shift, h)
+	if n.bitmap&bit == 0 {
+		slots := make([]hamtSlot, 0, len(n.slots)+1)
+		slots = append(slots, n.slots[:pos]...)
+		slots = append(slots, hamtSlot{hash: h, entries: []mapEntry{e}})
+		slots = append(slots, n.slots[pos:]...)
+		return &hamtNode{bitmap: n.bitmap | bit, slots: slots}, true
+	}
+
+	slot := n.slots[pos]
+	added := true
+	switch {
+	case slot.node != nil:
+		slot.node, added = slot.node.assoc(shift+hamtBits, h, e)
+	case slot.hash == h:
+		entries := append([]mapEntry{}, slot.entries...)
+		for i, old := range entries {
+			if old.key.IsEqaulTo(e.key) {
+				e.seq = old.seq
+				entries[i], added = e, false
+				break
+			}
+		}
+		if added {
+			entries = append(entries, e)
+		}
+		slot.entries = entries
+	default: // push both leaves down into a new node
+		node := &hamtNode{}
+		node, _ = node.assoc(shift+hamtBits, slot.hash, slot.entries[0])
+		for _, old := range slot.entries[1:] {
+			node, _ = node.assoc(shift+hamtBits, slot.hash, old)
+		}
+		node, _ = node.assoc(shift+hamtBits, h, e)
+		slot = hamtSlot{node: node}
+	}
+	slots := append([]hamtSlot{}, n.slots...)
+	slots[pos] = slot
+	return &hamtNode{bitmap: n.bitmap, slots: slots}, added
+}
+
+func (n *hamtNode) dissoc(shift uint, h uint64, k MapKey) (*hamtNode, bool) {
+	bit, pos := n.index(shift, h)
+	if n.bitmap&bit == 0 {
+		return n, false
+	}
+
+	slot := n.slots[pos]
+	if slot.node != nil {
+		node, removed := slot.node.dissoc(shift+hamtBits, h, k)
+		if !removed {
+			return n, false
+		}
+		slot.node = node
+		if node.bitmap == 0 {
+			slot.node = nil
+		}
+	} else {
+		if slot.hash != h {
+			return n, false
+		}
+		i := 0
+		for i < len(slot.entries) && !slot.entries[i].key.IsEqaulTo(k) {
+			i++
+		}
+		if i == len(slot.entries) {
+			return n, false
+		}
+		entries := make([]mapEntry, 0, len(slot.entries)-1)
+		entries = append(entries, slot.entries[:i]...)
+		slot.entries = append(entries, slot.entries[i+1:]...)
+	}
+
+	if slot.node == nil && len(slot.entries) == 0 {
+		slots := make([]hamtSlot, 0, len(n.slots)-1)
+		slots = append(slots, n.slots[:pos]...)
+		slots = append(slots, n.slots[pos+1:]...)
+		return &hamtNode{bitmap: n.bitmap &^ bit, slots: slots}, true
+	}
+	slots := append([]hamtSlot{}, n.slots...)
+	slots[pos] = slot
+	return &hamtNode{bitmap: n.bitmap, slots: slots}, true
+}
+
+func (n *hamtNode) appendEntries(entries []mapEntry) []mapEntry {
+	for _, slot := range n.slots {
+		if slot.node != nil {
+			entries = slot.node.appendEntries(entries)
+		} else {
+			entries = append(entries, slot.entries...)
+		}
+	}
+	return entries
+}
+
+func NewMap() Map {
+	return Map{root: emptyHamtNode}
+}
+
+// node returns the root, the zero Map is an empty map as well.
+func (m Map) node() *hamtNode {
+	if m.root == nil {
+		return emptyHamtNode
+	}
+	return m.root
+}
+
+func (m Map) Len() int {
+	return m.n
+}
+
+func (m Map) Get(k Valuer) (Valuer, bool) {
+	key, ok := k.(MapKey)
+	if !ok {
+		return nil, false
+	}
+	e, ok := m.node().get(0, key.Hash(), key)
+	return e.value, ok
+}
+
+// Set replaces m with m.Assoc(k, v), it is handy to build a new map.
+func (m *Map) Set(k MapKey, v Valuer) {
+	*m = m.Assoc(k, v)
+}
+
+func (m Map) Assoc(k MapKey, v Valuer) Map {
+	root, added := m.node().assoc(0, k.Hash(), mapEntry{key: k, value: v, seq: m.next})
+	m.root = root
+	if added {
+		m.n++
+		m.next++
+	}
+	return m
+}
+
+func (m Map) Dissoc(k Valuer) Map {
+	key, ok := k.(MapKey)
+	if !ok {
+		return m
+	}
+	root, removed := m.node().dissoc(0, key.Hash(), key)
+	m.root = root
+	if removed {
+		m.n--
+	}
+	return m
+}
+
+// entries returns all entries in insertion order.
+func (m Map) entries() []mapEntry {
+	entries := m.node().appendEntries(make([]mapEntry, 0, m.n))
+	sort.Slice(entries, func(i, j int) bool { return entries[i].seq < entries[j].seq })
+	return entries
+}
+
+func (m Map) Keys() []Valuer {
+	keys := make([]Valuer, 0, m.n)
+	for _, e := range m.entries() {
+		keys = append(keys, e.key)
+	}
+	return keys
+}
+
+func (m Map) Vals() []Valuer {
+	vals := make([]Valuer, 0, m.n)
+	for _, e := range m.entries() {
+		vals = append(vals, e.value)
+	}
+	return vals
+}
+
+func (m Map) Meta() Valuer {
+	return metaOrNil(m.meta)
+}
+
+func (m Map) WithMeta(meta Valuer) Valuer {
+	m.meta = meta
+	return m
+}
+
+func (m Map) IsEqaulTo(oth Valuer) bool {
+	o, ok := oth.(Map)
+	if !ok {
+		return false
+	}
+
+	if m.n != o.n {
+		return false
+	}
+	for _, e := range m.node().appendEntries(nil) {
+		ov, ok := o.Get(e.key)
+		if !ok || !e.value.IsEqaulTo(ov) {
+			return false
+		}
+	}
+	return true
+}
+
+// Hash does not depend on the order of entries.
+func (m Map) Hash() uint64 {
+	var h uint64
+	for _, e := range m.node().appendEntries(nil) {
+		h += uint64(newSeqHash().add(e.key).add(e.value))
+	}
+	return h
+}
+
+func (m Map) SPrint(readable bool) string {
+	elems := []string{"{"}
+	for i, e := range m.entries() {
+		sk := e.key.SPrint(readable)
+		sv := e.value.SPrint(readable)
+		if i == 0 {
+			elems = append(elems, fmt.Sprintf("%s %s", sk, sv))
+		} else {
+			elems = append(elems, fmt.Sprintf(" %s %s", sk, sv))
+		}
+	}
+	elems = append(elems, "}")
+	return strings.Join(elems, "")
+}
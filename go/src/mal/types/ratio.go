@@ -0,0 +1,112 @@
+package types
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// NewRatio parses the ratio literal like 3/4.
+func NewRatio(v string) (Number, error) {
+	x, ok := new(big.Rat).SetString(strings.Replace(v, "_", "", -1))
+	if !ok {
+		return nil, fmt.Errorf("invalid ratio: %s", v)
+	}
+	return newRatio(x), nil
+}
+
+// newRatio returns x as integer if its denominator is 1, otherwise Ratio.
+func newRatio(x *big.Rat) Number {
+	if x.IsInt() {
+		return NewBigInt(new(big.Int).Set(x.Num()))
+	}
+	return Ratio{x: x}
+}
+
+func (r Ratio) Add(oth Number) (Number, error) {
+	if f, ok := oth.(Float); ok {
+		return r.float().Add(f)
+	}
+	y, err := toBigRat(oth)
+	if err != nil {
+		return nil, err
+	}
+	return newRatio(new(big.Rat).Add(r.x, y)), nil
+}
+
+func (r Ratio) Sub(oth Number) (Number, error) {
+	if f, ok := oth.(Float); ok {
+		return r.float().Sub(f)
+	}
+	y, err := toBigRat(oth)
+	if err != nil {
+		return nil, err
+	}
+	return newRatio(new(big.Rat).Sub(r.x, y)), nil
+}
+
+func (r Ratio) Mul(oth Number) (Number, error) {
+	if f, ok := oth.(Float); ok {
+		return r.float().Mul(f)
+	}
+	y, err := toBigRat(oth)
+	if err != nil {
+		return nil, err
+	}
+	return newRatio(new(big.Rat).Mul(r.x, y)), nil
+}
+
+func (r Ratio) Div(oth Number) (Number, error) {
+	if f, ok := oth.(Float); ok {
+		return r.float().Div(f)
+	}
+	y, err := toBigRat(oth)
+	if err != nil {
+		return nil, err
+	}
+	if y.Sign() == 0 {
+		return nil, ErrDivideByZero
+	}
+	return newRatio(new(big.Rat).Quo(r.x, y)), nil
+}
+
+func (r Ratio) Compare(oth Number) (int, error) {
+	if f, ok := oth.(Float); ok {
+		return -compareFloat(f, r.x), nil
+	}
+	y, err := toBigRat(oth)
+	if err != nil {
+		return 0, err
+	}
+	return r.x.Cmp(y), nil
+}
+
+func (r Ratio) IsEqaulTo(oth Valuer) bool {
+	o, ok := oth.(Ratio)
+	return ok && r.x.Cmp(o.x) == 0
+}
+
+func (r Ratio) SPrint(readable bool) string {
+	return r.x.String()
+}
+
+func (r Ratio) Hash() uint64 {
+	return hashString('r', r.x.String())
+}
+
+func (r Ratio) float() Float {
+	f, _ := r.x.Float64()
+	return Float(f)
+}
+
+func toBigRat(n Number) (*big.Rat, error) {
+	switch x := n.(type) {
+	case Int:
+		return new(big.Rat).SetInt64(int64(x)), nil
+	case BigInt:
+		return new(big.Rat).SetInt(x.x), nil
+	case Ratio:
+		return x.x, nil
+	}
+	return nil, unknownNumber(n)
+}
@@ -0,0 +1,69 @@
+package types
+
+import (
+	"regexp"
+	"strings"
+)
+
+func NewRegex(pattern string) (Regex, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return Regex{}, err
+	}
+	// whole prefers the longest match, see MatchWhole.
+	whole, err := regexp.Compile(pattern)
+	if err != nil {
+		return Regex{}, err
+	}
+	whole.Longest()
+	return Regex{re: re, whole: whole}, nil
+}
+
+// Regexp returns the compiled expression.
+func (r Regex) Regexp() *regexp.Regexp {
+	return r.re
+}
+
+// MatchWhole returns the indexes of the match and its groups like
+// FindStringSubmatchIndex, but only if the match spans the whole s. The
+// leftmost-longest match spans s whenever any match does.
+func (r Regex) MatchWhole(s string) []int {
+	loc := r.whole.FindStringSubmatchIndex(s)
+	if loc == nil || loc[0] != 0 || loc[1] != len(s) {
+		return nil
+	}
+	return loc
+}
+
+func (r Regex) IsEqaulTo(oth Valuer) bool {
+	o, ok := oth.(Regex)
+	return ok && r.re.String() == o.re.String()
+}
+
+// SPrint escapes '"' if readable so that the reader can read the literal
+// back, e.g. #"a\"b", the escaped ones are kept as they are.
+func (r Regex) SPrint(readable bool) string {
+	if !readable {
+		return r.re.String()
+	}
+	var b strings.Builder
+	b.WriteString(`#"`)
+	escaped := false
+	for _, c := range r.re.String() {
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '"':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func (r Regex) Hash() uint64 {
+	return hashString('x', r.re.String())
+}
@@ -0,0 +1,76 @@
+package types
+
+import "strings"
+
+func NewSet(elems ...MapKey) Set {
+	s := Set{m: NewMap()}
+	for _, elem := range elems {
+		s.m.Set(elem, elem)
+	}
+	return s
+}
+
+func (s Set) Len() int {
+	return s.m.Len()
+}
+
+func (s Set) Contains(v Valuer) bool {
+	_, ok := s.m.Get(v)
+	return ok
+}
+
+// Conj returns a new set with v added.
+func (s Set) Conj(v MapKey) Set {
+	s.m = s.m.Assoc(v, v)
+	return s
+}
+
+// Disj returns a new set without v.
+func (s Set) Disj(v Valuer) Set {
+	s.m = s.m.Dissoc(v)
+	return s
+}
+
+// Elems returns the elements in insertion order.
+func (s Set) Elems() []Valuer {
+	return s.m.Keys()
+}
+
+func (s Set) Meta() Valuer {
+	return metaOrNil(s.meta)
+}
+
+func (s Set) WithMeta(meta Valuer) Valuer {
+	s.meta = meta
+	return s
+}
+
+func (s Set) IsEqaulTo(oth Valuer) bool {
+	o, ok := oth.(Set)
+	if !ok || s.Len() != o.Len() {
+		return false
+	}
+	for _, elem := range s.Elems() {
+		if !o.Contains(elem) {
+			return false
+		}
+	}
+	return true
+}
+
+// Hash does not depend on the order of elements.
+func (s Set) Hash() uint64 {
+	h := hashString('#', "")
+	for _, elem := range s.Elems() {
+		h += elem.(MapKey).Hash()
+	}
+	return h
+}
+
+func (s Set) SPrint(readable bool) string {
+	elems := []string{}
+	for _, elem := range s.Elems() {
+		elems = append(elems, elem.SPrint(readable))
+	}
+	return "#{" + strings.Join(elems, " ") + "}"
+}
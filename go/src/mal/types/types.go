@@ -1,11 +1,14 @@
 package types
 
 import (
-	"container/list"
+	"errors"
 	"fmt"
 	"math"
+	"math/big"
+	"regexp"
 	"strconv"
 	"strings"
+	"unicode"
 )
 
 type (
@@ -15,39 +18,94 @@ type (
 	}
 	Number interface {
 		Valuer
-		Add(Number) Number
-		Sub(Number) Number
-		Mul(Number) Number
-		Div(Number) Number
-		Compare(Number) int
-	}
+		Add(Number) (Number, error)
+		Sub(Number) (Number, error)
+		Mul(Number) (Number, error)
+		Div(Number) (Number, error)
+		Compare(Number) (int, error)
+	}
+	// MapKey is implemented by the immutable values, equal values must
+	// have the same hash.
 	MapKey interface {
 		Valuer
-		Key()
+		Hash() uint64
+	}
+	Metadata interface {
+		Valuer
+		Meta() Valuer
+		WithMeta(meta Valuer) Valuer
 	}
 
 	FuncType func(...Valuer) (Valuer, error)
 )
 
+var (
+	ErrDivideByZero = errors.New("divide by zero")
+	ErrNaN          = errors.New("invalid operation: result is NaN")
+
+	Inf    = Float(math.Inf(1))
+	NegInf = Float(math.Inf(-1))
+	NaN    = Float(math.NaN())
+)
+
+// unknownNumber is returned if the operand is none of the number types.
+func unknownNumber(n Number) error {
+	return fmt.Errorf("unsupported number type: %T", n)
+}
+
 type (
 	Raw     struct{ x fmt.Stringer }
 	Nil     struct{}
 	Bool    bool
 	Int     int64
+	BigInt  struct{ x *big.Int }
+	Ratio   struct{ x *big.Rat }
 	Float   float64
 	String  string
+	Char    rune
+	Regex   struct{ re, whole *regexp.Regexp }
 	Keyword string
-	List    struct{ *list.List }
-	Vector  []Valuer
-	Map     map[Valuer]Valuer
-	Func    struct {
+	Symbol  string
+	// List is an immutable cons list, lists share their tails.
+	List struct {
+		cell *cons
+		meta Valuer
+	}
+	// Vector is a persistent vector, the elements are stored in a 32-way
+	// trie and the last (up to 32) elements are kept in tail.
+	Vector struct {
+		cnt   int
+		shift uint
+		root  *vecNode
+		tail  []Valuer
+		meta  Valuer
+	}
+	// Set is a persistent set, the elements are stored as keys of m.
+	Set struct {
+		m    Map
+		meta Valuer
+	}
+	// Map is a persistent hash array mapped trie.
+	Map struct {
+		root *hamtNode
+		n    int
+		next int // the seq of next new entry
+		meta Valuer
+	}
+	Func struct {
 		name string
 		Exec FuncType
+		meta Valuer
 	}
 	LambdaFunc struct {
-		Binds []string
-		Env   interface{}
-		Expr  interface{}
+		Binds   []string
+		Env     interface{}
+		Expr    interface{}
+		IsMacro bool
+		meta    Valuer
+	}
+	Atom struct {
+		Value Valuer
 	}
 )
 
@@ -73,60 +131,138 @@ func (n Nil) SPrint(readable bool) string {
 	return "nil"
 }
 
-func NewInt(v string) Int {
-	x, _ := strconv.ParseInt(v, 10, 64)
-	return Int(x)
+func (n Nil) Hash() uint64 {
+	return hashString('n', "")
 }
 
-func (i Int) Add(oth Number) Number {
+// NewInt parses the integer literal like -42, 0x2a, 0o52, 0b101010 or
+// 1_000, it returns BigInt if v overflows int64.
+func NewInt(v string) Number {
+	base, digits := 10, strings.TrimLeft(v, "+-")
+	if len(digits) > 2 && digits[0] == '0' {
+		switch digits[1] {
+		case 'x', 'X':
+			base = 16
+		case 'o', 'O':
+			base = 8
+		case 'b', 'B':
+			base = 2
+		}
+		if base != 10 {
+			digits = digits[2:]
+		}
+	}
+	x, _ := new(big.Int).SetString(strings.Replace(digits, "_", "", -1), base)
+	if strings.HasPrefix(v, "-") {
+		x.Neg(x)
+	}
+	return NewBigInt(x)
+}
+
+func (i Int) Add(oth Number) (Number, error) {
 	switch x := oth.(type) {
 	case Int:
-		return i + x
+		if r := i + x; (r > i) == (x > 0) {
+			return r, nil
+		}
+		return i.big().Add(x)
 	case Float:
-		return Float(i) + x
+		return Float(i).Add(x)
+	case BigInt:
+		return i.big().Add(x)
+	case Ratio:
+		return i.ratio().Add(x)
 	}
-	panic("try again?")
+	return nil, unknownNumber(oth)
 }
 
-func (i Int) Sub(oth Number) Number {
+func (i Int) Sub(oth Number) (Number, error) {
 	switch x := oth.(type) {
 	case Int:
-		return i - x
+		if r := i - x; (r < i) == (x > 0) {
+			return r, nil
+		}
+		return i.big().Sub(x)
 	case Float:
-		return Float(i) - x
+		return Float(i).Sub(x)
+	case BigInt:
+		return i.big().Sub(x)
+	case Ratio:
+		return i.ratio().Sub(x)
 	}
-	panic("try again?")
+	return nil, unknownNumber(oth)
 }
 
-func (i Int) Mul(oth Number) Number {
+func (i Int) Mul(oth Number) (Number, error) {
 	switch x := oth.(type) {
 	case Int:
-		return i * x
+		if i == 0 || x == 0 {
+			return Int(0), nil
+		}
+		overflow := (i == -1 && x == math.MinInt64) || (x == -1 && i == math.MinInt64)
+		if r := i * x; !overflow && r/x == i {
+			return r, nil
+		}
+		return i.big().Mul(x)
 	case Float:
-		return Float(i) * x
+		return Float(i).Mul(x)
+	case BigInt:
+		return i.big().Mul(x)
+	case Ratio:
+		return i.ratio().Mul(x)
 	}
-	panic("try again?")
+	return nil, unknownNumber(oth)
 }
 
-func (i Int) Div(oth Number) Number {
-	// FIXME: divide by zero
+func (i Int) Div(oth Number) (Number, error) {
 	switch x := oth.(type) {
 	case Int:
-		return i / x
+		if x == 0 {
+			return nil, ErrDivideByZero
+		}
+		if i == math.MinInt64 && x == -1 {
+			return i.big().Div(x)
+		}
+		if i%x != 0 {
+			return i.ratio().Div(x)
+		}
+		return i / x, nil
 	case Float:
-		return Float(i) / x
+		return Float(i).Div(x)
+	case BigInt:
+		return i.big().Div(x)
+	case Ratio:
+		return i.ratio().Div(x)
 	}
-	panic("try again?")
+	return nil, unknownNumber(oth)
 }
 
-func (i Int) Compare(oth Number) int {
+func (i Int) Compare(oth Number) (int, error) {
 	switch x := oth.(type) {
 	case Int:
-		return int(i - x)
+		switch {
+		case i < x:
+			return -1, nil
+		case i > x:
+			return 1, nil
+		}
+		return 0, nil
 	case Float:
-		return int(math.Ceil(float64(Float(i) - x)))
+		return -compareFloat(x, i.ratio().x), nil
+	case BigInt:
+		return i.big().Compare(x)
+	case Ratio:
+		return i.ratio().Compare(x)
 	}
-	panic("try again?")
+	return 0, unknownNumber(oth)
+}
+
+func (i Int) big() BigInt {
+	return BigInt{x: big.NewInt(int64(i))}
+}
+
+func (i Int) ratio() Ratio {
+	return Ratio{x: new(big.Rat).SetInt64(int64(i))}
 }
 
 func (i Int) IsEqaulTo(oth Valuer) bool {
@@ -138,60 +274,119 @@ func (i Int) SPrint(readable bool) string {
 	return fmt.Sprintf("%d", i)
 }
 
+func (i Int) Hash() uint64 {
+	return hashString('i', i.SPrint(false))
+}
+
 func NewFloat(v string) Float {
-	x, _ := strconv.ParseFloat(v, 64)
+	switch v {
+	case "##Inf":
+		return Inf
+	case "##-Inf":
+		return NegInf
+	case "##NaN":
+		return NaN
+	}
+	x, _ := strconv.ParseFloat(strings.Replace(v, "_", "", -1), 64)
 	return Float(x)
 }
 
-func (f Float) Add(oth Number) Number {
-	switch x := oth.(type) {
-	case Int:
-		return f + Float(x)
-	case Float:
-		return f + x
+func (f Float) Add(oth Number) (Number, error) {
+	return f.apply(oth, func(x Float) Float { return f + x })
+}
+
+func (f Float) Sub(oth Number) (Number, error) {
+	return f.apply(oth, func(x Float) Float { return f - x })
+}
+
+func (f Float) Mul(oth Number) (Number, error) {
+	return f.apply(oth, func(x Float) Float { return f * x })
+}
+
+func (f Float) Div(oth Number) (Number, error) {
+	x, err := toFloat(oth)
+	if err != nil {
+		return nil, err
+	}
+	if x == 0 {
+		return nil, ErrDivideByZero
 	}
-	panic("try again?")
+	return f.apply(x, func(x Float) Float { return f / x })
 }
 
-func (f Float) Sub(oth Number) Number {
-	switch x := oth.(type) {
-	case Int:
-		return f - Float(x)
-	case Float:
-		return f - x
+// apply converts oth into Float and returns op(oth), ErrNaN is returned if the
+// result is NaN but neither operand is, e.g. inf - inf, NaN operands simply
+// propagate.
+func (f Float) apply(oth Number, op func(Float) Float) (Number, error) {
+	x, err := toFloat(oth)
+	if err != nil {
+		return nil, err
+	}
+	if r := op(x); !r.IsNaN() || f.IsNaN() || x.IsNaN() {
+		return r, nil
 	}
-	panic("try again?")
+	return nil, ErrNaN
 }
 
-func (f Float) Mul(oth Number) Number {
-	switch x := oth.(type) {
-	case Int:
-		return f * Float(x)
+func (f Float) IsNaN() bool {
+	return math.IsNaN(float64(f))
+}
+
+func (f Float) IsInf() bool {
+	return math.IsInf(float64(f), 0)
+}
+
+// Truncate returns the integer part of n.
+func Truncate(n Number) (Number, error) {
+	switch x := n.(type) {
 	case Float:
-		return f * x
+		if x.IsNaN() || x.IsInf() {
+			return nil, fmt.Errorf("cannot convert %s to int", x.SPrint(true))
+		}
+		i, _ := big.NewFloat(float64(x)).Int(nil)
+		return NewBigInt(i), nil
+	case Ratio:
+		return NewBigInt(new(big.Int).Quo(x.x.Num(), x.x.Denom())), nil
 	}
-	panic("try again?")
+	return n, nil
 }
 
-func (f Float) Div(oth Number) Number {
-	// FIXME: divide by zero
-	switch x := oth.(type) {
+func toFloat(n Number) (Float, error) {
+	switch x := n.(type) {
 	case Int:
-		return f / Float(x)
+		return Float(x), nil
 	case Float:
-		return f / x
+		return x, nil
+	case BigInt:
+		return x.float(), nil
+	case Ratio:
+		return x.float(), nil
+	}
+	return 0, unknownNumber(n)
+}
+
+func (f Float) Compare(oth Number) (int, error) {
+	if x, ok := oth.(Float); ok {
+		switch {
+		case f < x:
+			return -1, nil
+		case f > x:
+			return 1, nil
+		}
+		return 0, nil
+	}
+	x, err := toBigRat(oth)
+	if err != nil {
+		return 0, err
 	}
-	panic("try again?")
+	return compareFloat(f, x), nil
 }
 
-func (f Float) Compare(oth Number) int {
-	switch x := oth.(type) {
-	case Int:
-		return int(math.Ceil(float64(f - Float(x))))
-	case Float:
-		return int(math.Ceil(float64(f - x)))
+func (f Float) Hash() uint64 {
+	if f == 0 { // 0.0 and -0.0 are equal
+		f = 0
 	}
-	panic("try again?")
+	return hashString('f', strconv.FormatUint(math.Float64bits(float64(f)), 16))
 }
 
 func (f Float) IsEqaulTo(oth Valuer) bool {
@@ -199,8 +394,34 @@ func (f Float) IsEqaulTo(oth Valuer) bool {
 	return ok && f == o
 }
 
+// SPrint formats f with the shortest representation which reads back as the
+// same float, a decimal point is always included, e.g. 1.0 and 1.0e+21. The
+// special floats are printed as ##Inf, ##-Inf and ##NaN if readable.
 func (f Float) SPrint(readable bool) string {
-	return fmt.Sprintf("%f", f)
+	switch {
+	case f.IsNaN():
+		if readable {
+			return "##NaN"
+		}
+		return "NaN"
+	case f.IsInf():
+		sign := ""
+		if f < 0 {
+			sign = "-"
+		}
+		if readable {
+			return "##" + sign + "Inf"
+		}
+		return sign + "Infinity"
+	}
+	s := strconv.FormatFloat(float64(f), 'g', -1, 64)
+	if strings.Contains(s, ".") {
+		return s
+	}
+	if i := strings.IndexByte(s, 'e'); i >= 0 {
+		return s[:i] + ".0" + s[i:]
+	}
+	return s + ".0"
 }
 
 func NewBool(v string) Bool {
@@ -222,6 +443,10 @@ func (b Bool) SPrint(readable bool) string {
 	return "false"
 }
 
+func (b Bool) Hash() uint64 {
+	return hashString('b', b.SPrint(false))
+}
+
 func (s String) IsEqaulTo(oth Valuer) bool {
 	o, ok := oth.(String)
 	return ok && s == o
@@ -229,190 +454,91 @@ func (s String) IsEqaulTo(oth Valuer) bool {
 
 func (s String) SPrint(readable bool) string {
 	if readable {
-		return fmt.Sprintf("%q", string(s))
+		return quote(string(s))
 	}
 	return string(s)
 }
 
-func (String) Key() {}
-
-func (k Keyword) IsEqaulTo(oth Valuer) bool {
-	o, ok := oth.(Keyword)
-	return ok && k == o
-}
-
-func (k Keyword) SPrint(readable bool) string {
-	return fmt.Sprintf(":%s", string(k))
-}
-
-func (Keyword) Key() {}
-
-func NewList() List {
-	return List{List: list.New()}
-}
-
-func (l List) Append(vs ...Valuer) {
-	for _, v := range vs {
-		l.PushBack(v)
-	}
-}
-
-func (l List) ToVector() *Vector {
-	vec := &Vector{}
-	for e := l.Front(); e != nil; e = e.Next() {
-		vec.Append(e.Value.(Valuer))
-	}
-	return vec
-}
-
-func (l List) IsEqaulTo(oth Valuer) bool {
-	var o List
-	switch x := oth.(type) {
-	case *Vector:
-		return l.ToVector().IsEqaulTo(x)
-	case List:
-		o = x
-	default:
-		return false
-	}
-
-	if l.Len() != o.Len() {
-		return false
-	}
-	for e1, e2 := l.Front(), o.Front(); ; e1, e2 = e1.Next(), e2.Next() {
-		if e1 == nil && e2 == nil {
-			break
-		}
-		if e1 == nil && e2 != nil {
-			return false
-		}
-		if e1 != nil && e2 == nil {
-			return false
-		}
-		if !e1.Value.(Valuer).IsEqaulTo(e2.Value.(Valuer)) {
-			return false
+// quote escapes s in the way the reader understands, the non-printable
+// characters are written as \uXXXX.
+func quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\b':
+			b.WriteString(`\b`)
+		default:
+			if isPrint(r) {
+				b.WriteRune(r)
+			} else {
+				fmt.Fprintf(&b, `\u%04x`, r)
+			}
 		}
 	}
-	return true
+	b.WriteByte('"')
+	return b.String()
 }
 
-func (l List) SPrint(readable bool) string {
-	elems := []string{"("}
-	for i, elem := 0, l.Front(); elem != nil; i, elem = i+1, elem.Next() {
-		s := elem.Value.(Valuer).SPrint(readable)
-		if i == 0 {
-			elems = append(elems, s)
-		} else {
-			elems = append(elems, " "+s)
-		}
-	}
-	elems = append(elems, ")")
-	return strings.Join(elems, "")
+// isPrint reports whether r can be printed as it is, the characters beyond
+// \uffff are always printed since they can not be escaped.
+func isPrint(r rune) bool {
+	return r > 0xffff || unicode.IsPrint(r)
 }
 
-func (v *Vector) Append(elems ...Valuer) {
-	*v = append(*v, elems...)
+func (s String) Hash() uint64 {
+	return hashString('s', string(s))
 }
 
-func (v *Vector) Remove(elem Valuer) {
-	for i, x := range *v {
-		if x.IsEqaulTo(elem) {
-			copy((*v)[i:], (*v)[i+1:])
-			n := len(*v) - 1
-			(*v)[n] = nil
-			*v = (*v)[:n]
-			break
-		}
-	}
+func (k Keyword) IsEqaulTo(oth Valuer) bool {
+	o, ok := oth.(Keyword)
+	return ok && k == o
 }
 
-func (v *Vector) Len() int {
-	return len(*v)
+func (k Keyword) SPrint(readable bool) string {
+	return fmt.Sprintf(":%s", string(k))
 }
 
-func (v *Vector) ToList() List {
-	l := NewList()
-	l.Append((*v)...)
-	return l
+func (k Keyword) Hash() uint64 {
+	return hashString('k', string(k))
 }
 
-func (v *Vector) IsEqaulTo(oth Valuer) bool {
-	var o *Vector
-	switch x := oth.(type) {
-	case List:
-		return v.ToList().IsEqaulTo(x)
-	case *Vector:
-		o = x
-	default:
-		return false
-	}
-	o, ok := oth.(*Vector)
-	if !ok {
-		return false
-	}
-
-	n := len(*v)
-	if n != len(*o) {
-		return false
-	}
-	for i := 0; i < n; i++ {
-		if !(*v)[i].IsEqaulTo((*o)[i]) {
-			return false
-		}
-	}
-	return true
+func (s Symbol) IsEqaulTo(oth Valuer) bool {
+	o, ok := oth.(Symbol)
+	return ok && s == o
 }
 
-func (v *Vector) SPrint(readable bool) string {
-	elems := []string{"["}
-	for i, elem := range *v {
-		s := elem.SPrint(readable)
-		if i == 0 {
-			elems = append(elems, s)
-		} else {
-			elems = append(elems, " "+s)
-		}
-	}
-	elems = append(elems, "]")
-	return strings.Join(elems, "")
+func (s Symbol) SPrint(readable bool) string {
+	return string(s)
 }
 
-func (m Map) IsEqaulTo(oth Valuer) bool {
-	o, ok := oth.(Map)
-	if !ok {
-		return false
-	}
+func (s Symbol) Hash() uint64 {
+	return hashString('y', string(s))
+}
 
-	if len(m) != len(o) {
-		return false
-	}
-	for k, v := range m {
-		if !v.IsEqaulTo(o[k]) {
-			return false
-		}
-	}
-	return true
+func NewFunc(name string, fn FuncType) Func {
+	return Func{name: name, Exec: fn}
 }
 
-func (m Map) SPrint(readable bool) string {
-	elems := []string{"{"}
-	i := 0
-	for k, v := range m {
-		sk := k.SPrint(readable)
-		sv := v.SPrint(readable)
-		if i == 0 {
-			elems = append(elems, fmt.Sprintf("%s %s", sk, sv))
-		} else {
-			elems = append(elems, fmt.Sprintf(" %s %s", sk, sv))
-		}
-		i++
-	}
-	elems = append(elems, "}")
-	return strings.Join(elems, "")
+func (f Func) Meta() Valuer {
+	return metaOrNil(f.meta)
 }
 
-func NewFunc(name string, fn FuncType) Func {
-	return Func{name: name, Exec: fn}
+func (f Func) WithMeta(meta Valuer) Valuer {
+	f.meta = meta
+	return f
 }
 
 func (f Func) IsEqaulTo(Valuer) bool {
@@ -431,10 +557,42 @@ func NewLambdaFunc(env, expr interface{}, binds []string) LambdaFunc {
 	}
 }
 
+func (f LambdaFunc) Meta() Valuer {
+	return metaOrNil(f.meta)
+}
+
+func (f LambdaFunc) WithMeta(meta Valuer) Valuer {
+	f.meta = meta
+	return f
+}
+
 func (f LambdaFunc) IsEqaulTo(Valuer) bool {
 	return false
 }
 
 func (f LambdaFunc) SPrint(readable bool) string {
+	if f.IsMacro {
+		return "#<macro>"
+	}
 	return "#<function>"
 }
+
+func NewAtom(v Valuer) *Atom {
+	return &Atom{Value: v}
+}
+
+func (a *Atom) IsEqaulTo(oth Valuer) bool {
+	o, ok := oth.(*Atom)
+	return ok && a == o
+}
+
+func (a *Atom) SPrint(readable bool) string {
+	return fmt.Sprintf("(atom %s)", a.Value.SPrint(readable))
+}
+
+func metaOrNil(meta Valuer) Valuer {
+	if meta == nil {
+		return Nil{}
+	}
+	return meta
+}
@@ -0,0 +1,195 @@
+package types
+
+import "strings"
+
+const (
+	vecBits  = 5
+	vecWidth = 1 << vecBits
+	vecMask  = vecWidth - 1
+)
+
+// vecNode is either a branch with children or a leaf with elems, nodes are
+// never changed once they are reachable from a Vector.
+type vecNode struct {
+	children []*vecNode
+	elems    []Valuer
+}
+
+var emptyVecNode = &vecNode{}
+
+func NewVector(elems ...Valuer) *Vector {
+	v := &Vector{shift: vecBits, root: emptyVecNode}
+	for _, elem := range elems {
+		v = v.Conj(elem)
+	}
+	return v
+}
+
+func (v *Vector) Len() int {
+	return v.cnt
+}
+
+// tailOffset returns the index of the first element in tail.
+func (v *Vector) tailOffset() int {
+	if v.cnt < vecWidth {
+		return 0
+	}
+	return ((v.cnt - 1) >> vecBits) << vecBits
+}
+
+// leafFor returns the leaf elements which contain the i-th element.
+func (v *Vector) leafFor(i int) []Valuer {
+	if i >= v.tailOffset() {
+		return v.tail
+	}
+	node := v.root
+	for level := v.shift; level > 0; level -= vecBits {
+		node = node.children[(i>>level)&vecMask]
+	}
+	return node.elems
+}
+
+func (v *Vector) Nth(i int) Valuer {
+	return v.leafFor(i)[i&vecMask]
+}
+
+// Conj returns a new vector with elem appended.
+func (v *Vector) Conj(elem Valuer) *Vector {
+	r := *v
+	r.cnt++
+	if v.cnt-v.tailOffset() < vecWidth {
+		r.tail = append(append(make([]Valuer, 0, len(v.tail)+1), v.tail...), elem)
+		return &r
+	}
+
+	leaf := &vecNode{elems: v.tail}
+	if (v.cnt >> vecBits) > (1 << v.shift) { // the root is full
+		r.root = &vecNode{children: []*vecNode{v.root, newVecPath(v.shift, leaf)}}
+		r.shift += vecBits
+	} else {
+		r.root = v.pushTail(v.shift, v.root, leaf)
+	}
+	r.tail = []Valuer{elem}
+	return &r
+}
+
+func (v *Vector) pushTail(level uint, parent, leaf *vecNode) *vecNode {
+	i := ((v.cnt - 1) >> level) & vecMask
+	child := leaf
+	if level > vecBits {
+		if i < len(parent.children) {
+			child = v.pushTail(level-vecBits, parent.children[i], leaf)
+		} else {
+			child = newVecPath(level-vecBits, leaf)
+		}
+	}
+	children := append([]*vecNode{}, parent.children...)
+	if i < len(children) {
+		children[i] = child
+	} else {
+		children = append(children, child)
+	}
+	return &vecNode{children: children}
+}
+
+func newVecPath(level uint, leaf *vecNode) *vecNode {
+	if level == 0 {
+		return leaf
+	}
+	return &vecNode{children: []*vecNode{newVecPath(level-vecBits, leaf)}}
+}
+
+// Assoc returns a new vector whose i-th element is replaced by elem, i may
+// be equal to Len() to append.
+func (v *Vector) Assoc(i int, elem Valuer) *Vector {
+	if i == v.cnt {
+		return v.Conj(elem)
+	}
+	r := *v
+	if i >= v.tailOffset() {
+		r.tail = append([]Valuer{}, v.tail...)
+		r.tail[i&vecMask] = elem
+	} else {
+		r.root = assocVecNode(v.shift, v.root, i, elem)
+	}
+	return &r
+}
+
+func assocVecNode(level uint, node *vecNode, i int, elem Valuer) *vecNode {
+	if level == 0 {
+		elems := append([]Valuer{}, node.elems...)
+		elems[i&vecMask] = elem
+		return &vecNode{elems: elems}
+	}
+	children := append([]*vecNode{}, node.children...)
+	j := (i >> level) & vecMask
+	children[j] = assocVecNode(level-vecBits, children[j], i, elem)
+	return &vecNode{children: children}
+}
+
+// Elems returns a copy of all elements.
+func (v *Vector) Elems() []Valuer {
+	elems := make([]Valuer, 0, v.cnt)
+	for i := 0; i < v.cnt; i += vecWidth {
+		elems = append(elems, v.leafFor(i)...)
+	}
+	return elems
+}
+
+func (v *Vector) ToList() List {
+	return NewList(v.Elems()...)
+}
+
+func (v *Vector) Meta() Valuer {
+	return metaOrNil(v.meta)
+}
+
+func (v *Vector) WithMeta(meta Valuer) Valuer {
+	r := *v
+	r.meta = meta
+	return &r
+}
+
+func (v *Vector) IsEqaulTo(oth Valuer) bool {
+	var o *Vector
+	switch x := oth.(type) {
+	case List:
+		return v.ToList().IsEqaulTo(x)
+	case *Vector:
+		o = x
+	default:
+		return false
+	}
+
+	if v.cnt != o.cnt {
+		return false
+	}
+	for i := 0; i < v.cnt; i++ {
+		if !v.Nth(i).IsEqaulTo(o.Nth(i)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (v *Vector) Hash() uint64 {
+	h := newSeqHash()
+	for i := 0; i < v.cnt; i++ {
+		h = h.add(v.Nth(i))
+	}
+	return uint64(h)
+}
+
+func (v *Vector) SPrint(readable bool) string {
+	elems := []string{"["}
+	for i := 0; i < v.cnt; i++ {
+		s := v.Nth(i).SPrint(readable)
+		if i == 0 {
+			elems = append(elems, s)
+		} else {
+			elems = append(elems, " "+s)
+		}
+	}
+	elems = append(elems, "]")
+	return strings.Join(elems, "")
+}